@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"go_crowdfund/user"
+	"time"
+)
+
+const (
+	ActionUserSuspend       = "user.suspend"
+	ActionUserReinstate     = "user.reinstate"
+	ActionRoleGrant         = "user.role_grant"
+	ActionRoleRevoke        = "user.role_revoke"
+	ActionCampaignApprove   = "campaign.approve"
+	ActionCampaignReject    = "campaign.reject"
+	ActionCampaignFeature   = "campaign.feature"
+	ActionCampaignUnfeature = "campaign.unfeature"
+	ActionCampaignTakeDown  = "campaign.take_down"
+	ActionTransactionsView  = "campaign.transactions_view"
+)
+
+const (
+	TargetUser     = "user"
+	TargetCampaign = "campaign"
+)
+
+// Entry records one admin action: who did what to which target, and why.
+type Entry struct {
+	ID         int
+	ActorID    int    `gorm:"index"`
+	Action     string `gorm:"size:50;index"`
+	TargetType string `gorm:"size:30;index:idx_audit_entries_target"`
+	TargetID   int    `gorm:"index:idx_audit_entries_target"`
+	Reason     string `gorm:"type:text"`
+	Detail     string `gorm:"size:255"`
+	CreatedAt  time.Time
+	Actor      user.User
+}
+
+func (Entry) TableName() string {
+	return "audit_entries"
+}
@@ -0,0 +1,40 @@
+package audit
+
+import "time"
+
+type EntryFormatter struct {
+	ID         int       `json:"id"`
+	ActorID    int       `json:"actor_id"`
+	ActorName  string    `json:"actor_name"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func FormatEntry(entry Entry) EntryFormatter {
+	formatter := EntryFormatter{}
+	formatter.ID = entry.ID
+	formatter.ActorID = entry.ActorID
+	formatter.ActorName = entry.Actor.Name
+	formatter.Action = entry.Action
+	formatter.TargetType = entry.TargetType
+	formatter.TargetID = entry.TargetID
+	formatter.Reason = entry.Reason
+	formatter.Detail = entry.Detail
+	formatter.CreatedAt = entry.CreatedAt
+
+	return formatter
+}
+
+func FormatEntries(entries []Entry) []EntryFormatter {
+	entriesFormatter := []EntryFormatter{}
+
+	for _, entry := range entries {
+		entriesFormatter = append(entriesFormatter, FormatEntry(entry))
+	}
+
+	return entriesFormatter
+}
@@ -0,0 +1,18 @@
+package audit
+
+type ReasonInput struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+type RequiredReasonInput struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+type GetEntriesInput struct {
+	ActorID    int    `form:"actor_id" binding:"gte=0"`
+	Action     string `form:"action"`
+	TargetType string `form:"target_type"`
+	TargetID   int    `form:"target_id" binding:"gte=0"`
+	Limit      int    `form:"limit" binding:"gte=0,lte=100"`
+	Cursor     string `form:"cursor"`
+}
@@ -0,0 +1,63 @@
+package audit
+
+import "gorm.io/gorm"
+
+type Repository interface {
+	Save(entry Entry) (Entry, error)
+	FindAll(input GetEntriesInput, offset int, limit int) ([]Entry, int64, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *repository {
+	return &repository{db}
+}
+
+func (r *repository) Save(entry Entry) (Entry, error) {
+	err := r.db.Omit("Actor").Create(&entry).Error
+
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+func (r *repository) FindAll(input GetEntriesInput, offset int, limit int) ([]Entry, int64, error) {
+	var entries []Entry
+	var total int64
+
+	db := r.db.Model(&Entry{})
+
+	if input.ActorID != 0 {
+		db = db.Where("actor_id = ?", input.ActorID)
+	}
+
+	if input.Action != "" {
+		db = db.Where("action = ?", input.Action)
+	}
+
+	if input.TargetType != "" {
+		db = db.Where("target_type = ?", input.TargetType)
+	}
+
+	if input.TargetID != 0 {
+		db = db.Where("target_id = ?", input.TargetID)
+	}
+
+	err := db.Count(&total).Error
+
+	if err != nil {
+		return entries, total, err
+	}
+
+	err = db.Preload("Actor").Order("id desc").Offset(offset).Limit(limit).Find(&entries).Error
+
+	if err != nil {
+		return entries, total, err
+	}
+
+	return entries, total, nil
+}
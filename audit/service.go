@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"go_crowdfund/helper"
+	"go_crowdfund/policy"
+	"go_crowdfund/user"
+)
+
+const DefaultPageSize = 50
+
+type Service interface {
+	Record(actor user.User, action string, targetType string, targetID int, reason string, detail string) error
+	GetEntries(input GetEntriesInput, currentUser user.User) ([]Entry, helper.Pagination, error)
+}
+
+type service struct {
+	repository Repository
+}
+
+func NewService(repository Repository) *service {
+	return &service{repository}
+}
+
+func (s *service) Record(actor user.User, action string, targetType string, targetID int, reason string, detail string) error {
+	entry := Entry{}
+	entry.ActorID = actor.ID
+	entry.Action = action
+	entry.TargetType = targetType
+	entry.TargetID = targetID
+	entry.Reason = reason
+	entry.Detail = detail
+
+	_, err := s.repository.Save(entry)
+
+	return err
+}
+
+func (s *service) GetEntries(input GetEntriesInput, currentUser user.User) ([]Entry, helper.Pagination, error) {
+	err := policy.Authorize(currentUser, policy.AuditView)
+
+	if err != nil {
+		return []Entry{}, helper.Pagination{}, err
+	}
+
+	offset, err := helper.DecodeCursor(input.Cursor)
+
+	if err != nil {
+		return []Entry{}, helper.Pagination{}, err
+	}
+
+	limit := input.Limit
+
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+
+	entries, total, err := s.repository.FindAll(input, offset, limit)
+
+	if err != nil {
+		return entries, helper.Pagination{}, err
+	}
+
+	return entries, helper.NewPagination(total, offset, limit), nil
+}
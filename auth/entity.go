@@ -0,0 +1,44 @@
+package auth
+
+import "time"
+
+// RefreshToken is stored hashed. Every rotation issues a new token in the same
+// family, so reusing an already rotated token revokes the whole family.
+type RefreshToken struct {
+	ID           int
+	UserID       int    `gorm:"index"`
+	FamilyID     string `gorm:"size:64;index"`
+	TokenHash    string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt    time.Time
+	RevokedAt    *time.Time
+	ReplacedByID int
+	CreatedAt    time.Time
+}
+
+// RevokedToken denylists the jti of a logged out access token until it
+// expires on its own.
+type RevokedToken struct {
+	JTI       string `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time
+}
+
+type Session struct {
+	UserID       int
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// SigningKey is an asymmetric key pair used to sign access tokens. The newest
+// key that has not been rotated signs new tokens; rotated keys keep verifying
+// until they are retired, after every token they signed has expired.
+type SigningKey struct {
+	ID         int
+	KID        string `gorm:"size:32;uniqueIndex"`
+	Algorithm  string `gorm:"size:10"`
+	PublicKey  string `gorm:"type:text"`
+	PrivateKey string `gorm:"type:text"`
+	RotatedAt  *time.Time
+	RetiredAt  *time.Time `gorm:"index"`
+	CreatedAt  time.Time
+}
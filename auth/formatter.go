@@ -0,0 +1,55 @@
+package auth
+
+import "time"
+
+type SessionFormatter struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func FormatSession(session Session) SessionFormatter {
+	formatter := SessionFormatter{}
+	formatter.Token = session.AccessToken
+	formatter.RefreshToken = session.RefreshToken
+	formatter.ExpiresAt = session.ExpiresAt
+
+	return formatter
+}
+
+type JWKFormatter struct {
+	KeyType   string `json:"kty"`
+	KID       string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSFormatter struct {
+	Keys []JWKFormatter `json:"keys"`
+}
+
+func FormatJWKS(keys []SigningKey) (JWKSFormatter, error) {
+	formatter := JWKSFormatter{Keys: []JWKFormatter{}}
+
+	for _, key := range keys {
+		public, err := parsePublicKey(key)
+
+		if err != nil {
+			return formatter, err
+		}
+
+		jwkFormatter, err := jwk(key, public)
+
+		if err != nil {
+			return formatter, err
+		}
+
+		formatter.Keys = append(formatter.Keys, jwkFormatter)
+	}
+
+	return formatter, nil
+}
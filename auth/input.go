@@ -0,0 +1,9 @@
+package auth
+
+type RefreshSessionInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
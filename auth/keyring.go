@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// keyringRefreshInterval bounds how long an instance keeps using a key
+	// set after another instance rotated it.
+	keyringRefreshInterval = time.Minute
+	keyringMissRetry       = 5 * time.Second
+)
+
+type verificationKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+type keyring struct {
+	mu            sync.RWMutex
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    crypto.PrivateKey
+	keys          map[string]verificationKey
+	loadedAt      time.Time
+}
+
+func (s *jwtService) loadKeys() error {
+	records, err := s.repository.FindActiveSigningKeys()
+
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]verificationKey{}
+	var signing *SigningKey
+
+	for i, record := range records {
+		public, err := parsePublicKey(record)
+
+		if err != nil {
+			return err
+		}
+
+		keys[record.KID] = verificationKey{record.Algorithm, public}
+
+		if signing == nil && record.RotatedAt == nil {
+			signing = &records[i]
+		}
+	}
+
+	s.keyring.mu.Lock()
+	defer s.keyring.mu.Unlock()
+
+	s.keyring.keys = keys
+	s.keyring.loadedAt = time.Now()
+	s.keyring.signingKID = ""
+
+	if signing == nil {
+		return nil
+	}
+
+	method, err := signingMethod(signing.Algorithm)
+
+	if err != nil {
+		return err
+	}
+
+	private, err := parsePrivateKey(*signing, s.keyEncryptionKey)
+
+	if err != nil {
+		return err
+	}
+
+	s.keyring.signingKID = signing.KID
+	s.keyring.signingMethod = method
+	s.keyring.signingKey = private
+
+	return nil
+}
+
+func (s *jwtService) refreshKeysAfter(age time.Duration) error {
+	s.keyring.mu.RLock()
+	stale := time.Since(s.keyring.loadedAt) > age
+	s.keyring.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+
+	return s.loadKeys()
+}
+
+func (s *jwtService) signingKey() (string, jwt.SigningMethod, crypto.PrivateKey, error) {
+	err := s.refreshKeysAfter(keyringRefreshInterval)
+
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	s.keyring.mu.RLock()
+	defer s.keyring.mu.RUnlock()
+
+	if s.keyring.signingKID == "" {
+		return "", nil, nil, errors.New("no signing key available")
+	}
+
+	return s.keyring.signingKID, s.keyring.signingMethod, s.keyring.signingKey, nil
+}
+
+// verificationKey looks kid up among the non-retired keys, reloading them when
+// the kid is unknown since another instance may have just rotated.
+func (s *jwtService) verificationKey(kid string) (verificationKey, error) {
+	err := s.refreshKeysAfter(keyringRefreshInterval)
+
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	s.keyring.mu.RLock()
+	key, ok := s.keyring.keys[kid]
+	s.keyring.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	err = s.refreshKeysAfter(keyringMissRetry)
+
+	if err != nil {
+		return verificationKey{}, err
+	}
+
+	s.keyring.mu.RLock()
+	key, ok = s.keyring.keys[kid]
+	s.keyring.mu.RUnlock()
+
+	if !ok {
+		return key, errors.New("Unknown signing key")
+	}
+
+	return key, nil
+}
+
+// EnsureSigningKey creates a signing key when there is none in use yet, as
+// on the first start, and loads the keys. Unlike RotateKeys it is safe to
+// call from every instance at once: it never rotates a key another instance
+// may be signing with.
+func (s *jwtService) EnsureSigningKey() error {
+	records, err := s.repository.FindActiveSigningKeys()
+
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.RotatedAt == nil {
+			return s.loadKeys()
+		}
+	}
+
+	key, err := generateSigningKey(s.algorithm, s.keyEncryptionKey)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repository.SaveSigningKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	return s.loadKeys()
+}
+
+// RotateKeys makes sure a signing key for the configured algorithm exists and
+// is younger than the rotation interval, and retires rotated keys once every
+// token they signed has expired. It runs as a scheduled job, so only one
+// instance rotates at a time.
+func (s *jwtService) RotateKeys(now time.Time) error {
+	records, err := s.repository.FindActiveSigningKeys()
+
+	if err != nil {
+		return err
+	}
+
+	var current *SigningKey
+	for i, record := range records {
+		if record.RotatedAt == nil {
+			current = &records[i]
+			break
+		}
+	}
+
+	if current == nil || current.Algorithm != s.algorithm || now.Sub(current.CreatedAt) >= s.keyRotation {
+		key, err := generateSigningKey(s.algorithm, s.keyEncryptionKey)
+
+		if err != nil {
+			return err
+		}
+
+		key, err = s.repository.SaveSigningKey(key)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.repository.RotateSigningKeys(key.ID, now)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.repository.RetireSigningKeys(now.Add(-s.accessTokenTTL-keyringRefreshInterval), now)
+
+	if err != nil {
+		return err
+	}
+
+	return s.loadKeys()
+}
+
+func (s *jwtService) PublicKeys() ([]SigningKey, error) {
+	return s.repository.FindActiveSigningKeys()
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"go_crowdfund/secret"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmEdDSA:
+		return SigningMethodEdDSA, nil
+	}
+
+	return nil, errors.New("unsupported signing algorithm " + algorithm)
+}
+
+// generateSigningKey creates a key pair for algorithm. The private key is
+// sealed with kek before it is stored, so a database dump alone cannot mint
+// tokens.
+func generateSigningKey(algorithm string, kek []byte) (SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		_, err = signingMethod(algorithm)
+	}
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	kid, err := randomToken(12)
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	sealed, err := secret.Seal(kek, privateDER)
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key := SigningKey{}
+	key.KID = kid
+	key.Algorithm = algorithm
+	key.PublicKey = base64.StdEncoding.EncodeToString(publicDER)
+	key.PrivateKey = sealed
+
+	return key, nil
+}
+
+func parsePublicKey(key SigningKey) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key.PublicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParsePKIXPublicKey(der)
+}
+
+func parsePrivateKey(key SigningKey, kek []byte) (crypto.PrivateKey, error) {
+	der, err := secret.Open(kek, key.PrivateKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// jwk describes a public key in the JSON Web Key format.
+func jwk(key SigningKey, public crypto.PublicKey) (JWKFormatter, error) {
+	formatter := JWKFormatter{}
+	formatter.KID = key.KID
+	formatter.Algorithm = key.Algorithm
+	formatter.Use = "sig"
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		formatter.KeyType = "RSA"
+		formatter.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		formatter.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		formatter.KeyType = "OKP"
+		formatter.Curve = "Ed25519"
+		formatter.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return formatter, errors.New("unsupported public key type")
+	}
+
+	return formatter, nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	SaveRefreshToken(refreshToken RefreshToken) (RefreshToken, error)
+	FindRefreshTokenByHash(tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(old RefreshToken, next RefreshToken) (RefreshToken, bool, error)
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID int) error
+	RevokeToken(revokedToken RevokedToken) error
+	IsTokenRevoked(jti string) (bool, error)
+	DeleteExpired(now time.Time) error
+	FindActiveSigningKeys() ([]SigningKey, error)
+	SaveSigningKey(key SigningKey) (SigningKey, error)
+	RotateSigningKeys(newID int, now time.Time) error
+	RetireSigningKeys(rotatedBefore time.Time, now time.Time) error
+}
+
+var errConcurrentRotation = errors.New("refresh token already rotated")
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *repository {
+	return &repository{db}
+}
+
+func (r *repository) SaveRefreshToken(refreshToken RefreshToken) (RefreshToken, error) {
+	err := r.db.Create(&refreshToken).Error
+
+	if err != nil {
+		return refreshToken, err
+	}
+
+	return refreshToken, nil
+}
+
+func (r *repository) FindRefreshTokenByHash(tokenHash string) (RefreshToken, error) {
+	var refreshToken RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).Find(&refreshToken).Error
+
+	if err != nil {
+		return refreshToken, err
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken revokes old and stores next in one DB transaction. It
+// reports false, storing nothing, when old was already revoked by a
+// concurrent rotation.
+func (r *repository) RotateRefreshToken(old RefreshToken, next RefreshToken) (RefreshToken, bool, error) {
+	rotated := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&next).Error
+
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": next.ID})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errConcurrentRotation
+		}
+
+		rotated = true
+		return nil
+	})
+
+	if err == errConcurrentRotation {
+		return next, false, nil
+	}
+
+	if err != nil {
+		return next, false, err
+	}
+
+	return next, rotated, nil
+}
+
+func (r *repository) RevokeFamily(familyID string) error {
+	return r.db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *repository) RevokeAllForUser(userID int) error {
+	return r.db.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *repository) RevokeToken(revokedToken RevokedToken) error {
+	return r.db.Save(&revokedToken).Error
+}
+
+func (r *repository) IsTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *repository) DeleteExpired(now time.Time) error {
+	err := r.db.Where("expires_at < ?", now).Delete(&RevokedToken{}).Error
+
+	if err != nil {
+		return err
+	}
+
+	return r.db.Where("expires_at < ?", now).Delete(&RefreshToken{}).Error
+}
+
+func (r *repository) FindActiveSigningKeys() ([]SigningKey, error) {
+	var keys []SigningKey
+	err := r.db.Where("retired_at IS NULL").Order("created_at desc").Order("id desc").Find(&keys).Error
+
+	if err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+func (r *repository) SaveSigningKey(key SigningKey) (SigningKey, error) {
+	err := r.db.Create(&key).Error
+
+	if err != nil {
+		return key, err
+	}
+
+	return key, nil
+}
+
+// RotateSigningKeys marks the keys created before newID as rotated. Keys
+// created after it, by an instance rotating at the same time, stay in use.
+func (r *repository) RotateSigningKeys(newID int, now time.Time) error {
+	return r.db.Model(&SigningKey{}).
+		Where("id < ? AND rotated_at IS NULL", newID).
+		Update("rotated_at", now).Error
+}
+
+func (r *repository) RetireSigningKeys(rotatedBefore time.Time, now time.Time) error {
+	return r.db.Model(&SigningKey{}).
+		Where("retired_at IS NULL AND rotated_at < ?", rotatedBefore).
+		Update("retired_at", now).Error
+}
@@ -1,45 +1,81 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"log"
-	"os"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/joho/godotenv"
 )
 
+var ErrInvalidRefreshToken = errors.New("Invalid or expired refresh token")
+
 type Service interface {
 	GenerateToken(userID int) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	CreateSession(userID int) (Session, error)
+	RefreshSession(refreshToken string) (Session, error)
+	Logout(token *jwt.Token, refreshToken string) error
+	RevokeAllSessions(userID int) error
+	DeleteExpired(now time.Time) error
+	EnsureSigningKey() error
+	RotateKeys(now time.Time) error
+	PublicKeys() ([]SigningKey, error)
 }
 
 type jwtService struct {
+	keyEncryptionKey []byte
+	algorithm        string
+	keyRotation      time.Duration
+	repository       Repository
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	keyring          keyring
 }
 
-func goDotEnv(key string) string {
-	err := godotenv.Load(".env")
-
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
+// NewService signs access tokens with algorithm, rotating the key every
+// keyRotation. secretKey encrypts the private keys stored in the database.
+// Call EnsureSigningKey once before issuing tokens so a signing key exists.
+func NewService(secretKey string, algorithm string, keyRotation time.Duration, repository Repository, accessTokenTTL time.Duration, refreshTokenTTL time.Duration) *jwtService {
+	service := &jwtService{}
+	service.keyEncryptionKey = []byte(secretKey)
+	service.algorithm = algorithm
+	service.keyRotation = keyRotation
+	service.repository = repository
+	service.accessTokenTTL = accessTokenTTL
+	service.refreshTokenTTL = refreshTokenTTL
 
-	return os.Getenv(key)
+	return service
 }
 
-var SECRET_KEY = []byte(goDotEnv("JWT_SECRET_KEY"))
+func (s *jwtService) GenerateToken(userID int) (string, error) {
+	jti, err := randomToken(16)
 
-func NewService() *jwtService {
-	return &jwtService{}
-}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 
-func (s *jwtService) GenerateToken(userID int) (string, error) {
 	claim := jwt.MapClaims{}
 	claim["user_id"] = userID
+	claim["iat"] = now.Unix()
+	claim["exp"] = now.Add(s.accessTokenTTL).Unix()
+	claim["jti"] = jti
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
+	kid, method, privateKey, err := s.signingKey()
 
-	jwtSign, err := token.SignedString(SECRET_KEY)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claim)
+	token.Header["kid"] = kid
+
+	jwtSign, err := token.SignedString(privateKey)
 
 	if err != nil {
 		return jwtSign, err
@@ -48,20 +84,218 @@ func (s *jwtService) GenerateToken(userID int) (string, error) {
 	return jwtSign, nil
 }
 
+// ValidateToken accepts tokens signed by any non-retired key. It rejects
+// tokens without an expiry and tokens revoked by a logout.
 func (s *jwtService) ValidateToken(encodedToken string) (*jwt.Token, error) {
 	token, err := jwt.Parse(encodedToken, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := s.verificationKey(kid)
 
-		if !ok {
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.algorithm {
 			return nil, errors.New("Invalid Token")
 		}
 
-		return []byte(goDotEnv("JWT_SECRET_KEY")), nil
+		return key.public, nil
 	})
 
 	if err != nil {
 		return token, err
 	}
 
+	claim, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok || !claim.VerifyExpiresAt(time.Now().Unix(), true) {
+		return token, errors.New("Token has expired")
+	}
+
+	jti, _ := claim["jti"].(string)
+
+	if jti == "" {
+		return token, errors.New("Invalid Token")
+	}
+
+	revoked, err := s.repository.IsTokenRevoked(jti)
+
+	if err != nil {
+		return token, err
+	}
+
+	if revoked {
+		return token, errors.New("Token has been revoked")
+	}
+
 	return token, nil
 }
+
+func (s *jwtService) CreateSession(userID int) (Session, error) {
+	familyID, err := randomToken(16)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	refreshToken, plain, err := s.newRefreshToken(userID, familyID)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	_, err = s.repository.SaveRefreshToken(refreshToken)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	return s.newSession(userID, plain)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token in the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family is revoked.
+func (s *jwtService) RefreshSession(plain string) (Session, error) {
+	current, err := s.repository.FindRefreshTokenByHash(hashToken(plain))
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	if current.ID == 0 {
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil {
+		err := s.repository.RevokeFamily(current.FamilyID)
+
+		if err != nil {
+			return Session{}, err
+		}
+
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	next, nextPlain, err := s.newRefreshToken(current.UserID, current.FamilyID)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	_, rotated, err := s.repository.RotateRefreshToken(current, next)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	if !rotated {
+		err := s.repository.RevokeFamily(current.FamilyID)
+
+		if err != nil {
+			return Session{}, err
+		}
+
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	return s.newSession(current.UserID, nextPlain)
+}
+
+// Logout denylists the access token until it expires and, when given, revokes
+// the refresh token family it belongs to.
+func (s *jwtService) Logout(token *jwt.Token, refreshToken string) error {
+	claim, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return errors.New("Invalid Token")
+	}
+
+	jti, _ := claim["jti"].(string)
+	exp, _ := claim["exp"].(float64)
+	userID, _ := claim["user_id"].(float64)
+
+	err := s.repository.RevokeToken(RevokedToken{JTI: jti, ExpiresAt: time.Unix(int64(exp), 0)})
+
+	if err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	current, err := s.repository.FindRefreshTokenByHash(hashToken(refreshToken))
+
+	if err != nil {
+		return err
+	}
+
+	if current.ID == 0 || current.UserID != int(userID) {
+		return nil
+	}
+
+	return s.repository.RevokeFamily(current.FamilyID)
+}
+
+func (s *jwtService) RevokeAllSessions(userID int) error {
+	return s.repository.RevokeAllForUser(userID)
+}
+
+func (s *jwtService) DeleteExpired(now time.Time) error {
+	return s.repository.DeleteExpired(now)
+}
+
+func (s *jwtService) newSession(userID int, refreshToken string) (Session, error) {
+	accessToken, err := s.GenerateToken(userID)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	session := Session{}
+	session.UserID = userID
+	session.AccessToken = accessToken
+	session.RefreshToken = refreshToken
+	session.ExpiresAt = time.Now().Add(s.accessTokenTTL)
+
+	return session, nil
+}
+
+func (s *jwtService) newRefreshToken(userID int, familyID string) (RefreshToken, string, error) {
+	plain, err := randomToken(32)
+
+	if err != nil {
+		return RefreshToken{}, "", err
+	}
+
+	refreshToken := RefreshToken{}
+	refreshToken.UserID = userID
+	refreshToken.FamilyID = familyID
+	refreshToken.TokenHash = hashToken(plain)
+	refreshToken.ExpiresAt = time.Now().Add(s.refreshTokenTTL)
+
+	return refreshToken, plain, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+
+	_, err := rand.Read(buf)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package campaign
 
 import (
 	"go_crowdfund/user"
+	"strings"
 	"time"
 )
 
@@ -15,18 +16,133 @@ type Campaign struct {
 	BackerCount      int
 	GoalAmount       int
 	CurrentAmount    int
-	Slug             string
+	Slug             string `gorm:"size:255;uniqueIndex"`
+	Status           string `gorm:"size:20;default:live;index"`
+	FundingModel     string `gorm:"size:20;default:all_or_nothing"`
+	StartsAt         time.Time
+	EndsAt           time.Time `gorm:"index"`
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
+	CategoryID       int
+	FeaturedAt       *time.Time `gorm:"index"`
 	CampaignImages   []CampaignImages
+	RewardTiers      []RewardTier
+	Category         Category
+	Tags             []Tag `gorm:"many2many:campaign_tags"`
 	User             user.User
+	// UpdateCount and LatestUpdate summarise the published updates for the
+	// campaign page. The service fills them in; they are not stored.
+	UpdateCount  int64           `gorm:"-"`
+	LatestUpdate *CampaignUpdate `gorm:"-"`
 }
 
 type CampaignImages struct {
 	ID         int
 	CampaignID int
 	FileName   string
-	IsPrimary  int
+	// Variants lists, comma-separated, the resized copies stored next to
+	// the file.
+	Variants  string
+	IsPrimary int
+	// Position orders a campaign's images, starting at 1.
+	Position  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CampaignSlug keeps the slugs a campaign had before it was renamed, so old
+// links can be redirected to the current one.
+type CampaignSlug struct {
+	ID         int
+	CampaignID int    `gorm:"index"`
+	Slug       string `gorm:"size:255;uniqueIndex"`
 	CreatedAt  time.Time
-	UpdatedAt  time.Time
+}
+
+type Category struct {
+	ID          int
+	Name        string
+	Slug        string `gorm:"size:100;uniqueIndex"`
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Tag struct {
+	ID        int
+	Name      string
+	Slug      string `gorm:"size:100;uniqueIndex"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RewardTier is a reward backers can pick when pledging. A QuantityLimit of
+// zero means the tier is unlimited.
+type RewardTier struct {
+	ID                int
+	CampaignID        int
+	Title             string
+	Description       string
+	MinimumAmount     int
+	QuantityLimit     int
+	ClaimedCount      int
+	EstimatedDelivery time.Time
+	RequiresShipping  bool
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// CampaignUpdate is a news post from the creator. It is a draft until
+// PublishedAt, which may be in the future, and backers are emailed once it
+// is published. The Markdown Body of a BackersOnly update is only shown to
+// backers.
+type CampaignUpdate struct {
+	ID          int
+	CampaignID  int    `gorm:"index"`
+	Title       string `gorm:"size:255"`
+	Body        string `gorm:"type:text"`
+	BackersOnly bool
+	PublishedAt *time.Time `gorm:"index"`
+	NotifiedAt  *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// CampaignUpdateDelivery records the email of an update to one backer, so a
+// failed send is retried without mailing the backers who already got it.
+type CampaignUpdateDelivery struct {
+	ID               int
+	CampaignUpdateID int `gorm:"uniqueIndex:idx_campaign_update_deliveries_recipient"`
+	UserID           int `gorm:"uniqueIndex:idx_campaign_update_deliveries_recipient"`
+	Attempts         int
+	LastError        string
+	SentAt           *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (c Campaign) AcceptsPledges(now time.Time) bool {
+	return c.Status == StatusLive && !now.Before(c.StartsAt) && now.Before(c.EndsAt)
+}
+
+// VariantNames returns the set of variants stored comma-separated in
+// Variants.
+func (i CampaignImages) VariantNames() []string {
+	var names []string
+
+	for _, name := range strings.Split(i.Variants, ",") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (u CampaignUpdate) IsPublished(now time.Time) bool {
+	return u.PublishedAt != nil && !u.PublishedAt.After(now)
+}
+
+func (t RewardTier) IsSoldOut() bool {
+	return t.QuantityLimit > 0 && t.ClaimedCount >= t.QuantityLimit
 }
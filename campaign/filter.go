@@ -0,0 +1,138 @@
+package campaign
+
+import (
+	"errors"
+	"go_crowdfund/helper"
+	"go_crowdfund/policy"
+	"go_crowdfund/user"
+
+	"github.com/gosimple/slug"
+	"gorm.io/gorm"
+)
+
+const (
+	SortNewest      = "newest"
+	SortMostFunded  = "most_funded"
+	SortEndingSoon  = "ending_soon"
+	SortMostBackers = "most_backers"
+	SortRelevance   = "relevance"
+)
+
+const DefaultPageSize = 20
+
+// Filter narrows a campaign listing. Zero values mean "no constraint";
+// MinFunded and MaxFunded are percentages of the goal amount.
+type Filter struct {
+	IDs       []int
+	Statuses  []string
+	UserID    int
+	Category  string
+	Tags      []string
+	Featured  bool
+	MinGoal   int
+	MaxGoal   int
+	MinFunded int
+	MaxFunded int
+	Sort      string
+	Offset    int
+	Limit     int
+}
+
+// NewFilter builds the filter for a listing request. Owners and admins may
+// list any status; everyone else only sees public campaigns, live ones by
+// default.
+func NewFilter(input GetCampaignsInput, viewer user.User) (Filter, error) {
+	offset, err := helper.DecodeCursor(input.Cursor)
+
+	if err != nil {
+		return Filter{}, err
+	}
+
+	filter := Filter{
+		UserID:    input.UserID,
+		Category:  input.Category,
+		Tags:      input.Tags,
+		MinGoal:   input.MinGoal,
+		MaxGoal:   input.MaxGoal,
+		Featured:  input.Featured,
+		MinFunded: input.MinFunded,
+		MaxFunded: input.MaxFunded,
+		Sort:      input.Sort,
+		Offset:    offset,
+		Limit:     input.Limit,
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageSize
+	}
+
+	privileged := policy.CanOnOwned(viewer, policy.CampaignView, input.UserID)
+
+	switch {
+	case input.Status != "" && (privileged || IsPublic(input.Status)):
+		filter.Statuses = []string{input.Status}
+	case input.Status != "":
+		return Filter{}, errors.New("cannot list campaigns with that status")
+	case !privileged:
+		filter.Statuses = ListedStatuses
+	}
+
+	return filter, nil
+}
+
+func (f Filter) scope(db *gorm.DB) *gorm.DB {
+	if f.IDs != nil {
+		db = db.Where("campaigns.id IN ?", f.IDs)
+	}
+
+	if len(f.Statuses) > 0 {
+		db = db.Where("campaigns.status IN ?", f.Statuses)
+	}
+
+	if f.UserID != 0 {
+		db = db.Where("campaigns.user_id = ?", f.UserID)
+	}
+
+	if f.Category != "" {
+		db = db.Where("campaigns.category_id IN (SELECT id FROM categories WHERE slug = ?)", f.Category)
+	}
+
+	for _, tag := range f.Tags {
+		db = db.Where("campaigns.id IN (SELECT campaign_tags.campaign_id FROM campaign_tags JOIN tags ON tags.id = campaign_tags.tag_id WHERE tags.slug = ?)", slug.Make(tag))
+	}
+
+	if f.Featured {
+		db = db.Where("campaigns.featured_at IS NOT NULL")
+	}
+
+	if f.MinGoal > 0 {
+		db = db.Where("campaigns.goal_amount >= ?", f.MinGoal)
+	}
+
+	if f.MaxGoal > 0 {
+		db = db.Where("campaigns.goal_amount <= ?", f.MaxGoal)
+	}
+
+	if f.MinFunded > 0 {
+		db = db.Where("campaigns.current_amount * 100 >= campaigns.goal_amount * ?", f.MinFunded)
+	}
+
+	if f.MaxFunded > 0 {
+		db = db.Where("campaigns.current_amount * 100 <= campaigns.goal_amount * ?", f.MaxFunded)
+	}
+
+	return db
+}
+
+func (f Filter) order(db *gorm.DB) *gorm.DB {
+	switch f.Sort {
+	case SortMostFunded:
+		return db.Order("campaigns.current_amount desc").Order("campaigns.id desc")
+	case SortEndingSoon:
+		return db.Order("campaigns.ends_at asc").Order("campaigns.id asc")
+	case SortMostBackers:
+		return db.Order("campaigns.backer_count desc").Order("campaigns.id desc")
+	}
+
+	return db.Order("campaigns.created_at desc").Order("campaigns.id desc")
+}
@@ -1,16 +1,34 @@
 package campaign
 
-import "strings"
+import (
+	"go_crowdfund/storage"
+	"go_crowdfund/upload"
+	"time"
+)
 
 type CampaignFormatter struct {
-	ID               int    `json:"id"`
-	UserID           int    `json:"user_id"`
-	Name             string `json:"name"`
-	ShortDescription string `json:"short_description"`
-	ImageUrl         string `json:"image_url"`
-	GoalAmount       int    `json:"goal_amount"`
-	CurrentAmount    int    `json:"curren_amount"`
-	Slug             string `json:"slug"`
+	ID               int                `json:"id"`
+	UserID           int                `json:"user_id"`
+	Name             string             `json:"name"`
+	ShortDescription string             `json:"short_description"`
+	ImageUrl         string             `json:"image_url"`
+	ImageVariants    map[string]string  `json:"image_variants"`
+	GoalAmount       int                `json:"goal_amount"`
+	CurrentAmount    int                `json:"curren_amount"`
+	Slug             string             `json:"slug"`
+	Status           string             `json:"status"`
+	Featured         bool               `json:"featured"`
+	FundingModel     string             `json:"funding_model"`
+	StartsAt         time.Time          `json:"starts_at"`
+	EndsAt           time.Time          `json:"ends_at"`
+	Category         *CategoryFormatter `json:"category"`
+	Tags             []TagFormatter     `json:"tags"`
+}
+
+type CampaignSearchFormatter struct {
+	CampaignFormatter
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
 
 type CampaignDetailFormatter struct {
@@ -23,22 +41,69 @@ type CampaignDetailFormatter struct {
 	CurrentAmount    int                       `json:"current_amount"`
 	UserID           int                       `json:"user_id"`
 	Slug             string                    `json:"slug"`
-	Perks            []string                  `json:"perks"`
+	Status           string                    `json:"status"`
+	FundingModel     string                    `json:"funding_model"`
+	StartsAt         time.Time                 `json:"starts_at"`
+	EndsAt           time.Time                 `json:"ends_at"`
+	Category         *CategoryFormatter        `json:"category"`
+	Tags             []TagFormatter            `json:"tags"`
+	RewardTiers      []RewardTierFormatter     `json:"reward_tiers"`
 	User             CampaignUserFormatter     `json:"user"`
 	Images           []CampaignImagesFormatter `json:"images"`
+	UpdateCount      int64                     `json:"update_count"`
+	LatestUpdate     *CampaignUpdateFormatter  `json:"latest_update"`
+}
+
+type CategoryFormatter struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+}
+
+type TagFormatter struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
 }
 
 type CampaignUserFormatter struct {
-	Name     string `json:"name"`
-	ImageUrl string `json:"image_url"`
+	Name          string            `json:"name"`
+	ImageUrl      string            `json:"image_url"`
+	ImageVariants map[string]string `json:"image_variants"`
+}
+
+type RewardTierFormatter struct {
+	ID                int       `json:"id"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description"`
+	MinimumAmount     int       `json:"minimum_amount"`
+	QuantityLimit     int       `json:"quantity_limit"`
+	ClaimedCount      int       `json:"claimed_count"`
+	IsSoldOut         bool      `json:"is_sold_out"`
+	EstimatedDelivery time.Time `json:"estimated_delivery"`
+	RequiresShipping  bool      `json:"requires_shipping"`
+}
+
+type CampaignUpdateFormatter struct {
+	ID          int        `json:"id"`
+	CampaignID  int        `json:"campaign_id"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	BackersOnly bool       `json:"backers_only"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 type CampaignImagesFormatter struct {
-	ImageUrl  string `json:"image_url"`
-	IsPrimary bool   `json:"is_primary"`
+	ID        int               `json:"id"`
+	ImageUrl  string            `json:"image_url"`
+	Variants  map[string]string `json:"variants"`
+	IsPrimary bool              `json:"is_primary"`
+	Position  int               `json:"position"`
 }
 
-func FormatCampaign(campaign Campaign) CampaignFormatter {
+func FormatCampaign(campaign Campaign, files storage.Backend) CampaignFormatter {
 	formatter := CampaignFormatter{}
 	formatter.ID = campaign.ID
 	formatter.UserID = campaign.UserID
@@ -47,27 +112,52 @@ func FormatCampaign(campaign Campaign) CampaignFormatter {
 	formatter.GoalAmount = campaign.GoalAmount
 	formatter.CurrentAmount = campaign.CurrentAmount
 	formatter.Slug = campaign.Slug
+	formatter.Status = campaign.Status
+	formatter.Featured = campaign.FeaturedAt != nil
+	formatter.FundingModel = campaign.FundingModel
+	formatter.StartsAt = campaign.StartsAt
+	formatter.EndsAt = campaign.EndsAt
+	formatter.Category = formatCampaignCategory(campaign.Category)
+	formatter.Tags = FormatTags(campaign.Tags)
 	formatter.ImageUrl = ""
+	formatter.ImageVariants = map[string]string{}
 
 	if len(campaign.CampaignImages) > 0 {
-		formatter.ImageUrl = campaign.CampaignImages[0].FileName
+		image := campaign.CampaignImages[0]
+		formatter.ImageUrl = files.URL(storage.Key(image.FileName))
+		formatter.ImageVariants = formatVariants(files, image.FileName, image.VariantNames())
 	}
 
 	return formatter
 }
 
-func FormatCampaigns(campaign []Campaign) []CampaignFormatter {
+func FormatCampaigns(campaign []Campaign, files storage.Backend) []CampaignFormatter {
 	campaignsFormatter := []CampaignFormatter{}
 
 	for _, campaign := range campaign {
-		campaignFormatter := FormatCampaign(campaign)
+		campaignFormatter := FormatCampaign(campaign, files)
 		campaignsFormatter = append(campaignsFormatter, campaignFormatter)
 	}
 
 	return campaignsFormatter
 }
 
-func FormatCampaignDetail(campaign Campaign) CampaignDetailFormatter {
+func FormatSearchResults(results []SearchResult, files storage.Backend) []CampaignSearchFormatter {
+	searchFormatter := []CampaignSearchFormatter{}
+
+	for _, result := range results {
+		formatter := CampaignSearchFormatter{}
+		formatter.CampaignFormatter = FormatCampaign(result.Campaign, files)
+		formatter.Score = result.Score
+		formatter.Highlights = result.Highlights
+
+		searchFormatter = append(searchFormatter, formatter)
+	}
+
+	return searchFormatter
+}
+
+func FormatCampaignDetail(campaign Campaign, files storage.Backend) CampaignDetailFormatter {
 	campaignDetailFormatter := CampaignDetailFormatter{}
 
 	campaignDetailFormatter.ID = campaign.ID
@@ -77,45 +167,155 @@ func FormatCampaignDetail(campaign Campaign) CampaignDetailFormatter {
 	campaignDetailFormatter.GoalAmount = campaign.GoalAmount
 	campaignDetailFormatter.CurrentAmount = campaign.CurrentAmount
 	campaignDetailFormatter.Slug = campaign.Slug
+	campaignDetailFormatter.Status = campaign.Status
+	campaignDetailFormatter.FundingModel = campaign.FundingModel
+	campaignDetailFormatter.StartsAt = campaign.StartsAt
+	campaignDetailFormatter.EndsAt = campaign.EndsAt
+	campaignDetailFormatter.Category = formatCampaignCategory(campaign.Category)
+	campaignDetailFormatter.Tags = FormatTags(campaign.Tags)
 	campaignDetailFormatter.UserID = campaign.UserID
 	campaignDetailFormatter.ImageUrl = ""
 
-	if len(campaign.CampaignImages) > 0 {
-		campaignDetailFormatter.ImageUrl = campaign.CampaignImages[0].FileName
+	for _, image := range campaign.CampaignImages {
+		if image.IsPrimary == 1 {
+			campaignDetailFormatter.ImageUrl = files.URL(storage.Key(image.FileName))
+		}
 	}
 
-	var perks []string
-
-	for _, perk := range strings.Split(campaign.Perks, ",") {
-		perks = append(perks, strings.TrimSpace(perk))
+	rewardTiersFormatter := []RewardTierFormatter{}
+	for _, rewardTier := range campaign.RewardTiers {
+		rewardTiersFormatter = append(rewardTiersFormatter, FormatRewardTier(rewardTier))
 	}
 
-	campaignDetailFormatter.Perks = perks
+	campaignDetailFormatter.RewardTiers = rewardTiersFormatter
 
 	user := campaign.User
 	campaignUserFormatter := CampaignUserFormatter{}
 	campaignUserFormatter.Name = user.Name
-	campaignUserFormatter.ImageUrl = user.AvatarFileName
+	campaignUserFormatter.ImageUrl = files.URL(storage.Key(user.AvatarFileName))
+	campaignUserFormatter.ImageVariants = formatVariants(files, user.AvatarFileName, user.AvatarVariantNames())
 
 	campaignDetailFormatter.User = campaignUserFormatter
 
-	campaignImagesFormatter := []CampaignImagesFormatter{}
-	for _, image := range campaign.CampaignImages {
-		imageFormatter := CampaignImagesFormatter{}
-		imageFormatter.ImageUrl = image.FileName
+	campaignDetailFormatter.Images = FormatCampaignImages(campaign.CampaignImages, files)
+	campaignDetailFormatter.UpdateCount = campaign.UpdateCount
 
-		isPrime := false
+	if campaign.LatestUpdate != nil {
+		latestUpdate := FormatCampaignUpdate(*campaign.LatestUpdate)
+		campaignDetailFormatter.LatestUpdate = &latestUpdate
+	}
 
-		if image.IsPrimary == 1 {
-			isPrime = true
-		}
+	return campaignDetailFormatter
+}
+
+func FormatCampaignImage(image CampaignImages, files storage.Backend) CampaignImagesFormatter {
+	formatter := CampaignImagesFormatter{}
+	formatter.ID = image.ID
+	formatter.ImageUrl = files.URL(storage.Key(image.FileName))
+	formatter.Variants = formatVariants(files, image.FileName, image.VariantNames())
+	formatter.IsPrimary = image.IsPrimary == 1
+	formatter.Position = image.Position
+
+	return formatter
+}
 
-		imageFormatter.IsPrimary = isPrime
+func FormatCampaignImages(images []CampaignImages, files storage.Backend) []CampaignImagesFormatter {
+	imagesFormatter := []CampaignImagesFormatter{}
 
-		campaignImagesFormatter = append(campaignImagesFormatter, imageFormatter)
+	for _, image := range images {
+		imagesFormatter = append(imagesFormatter, FormatCampaignImage(image, files))
 	}
 
-	campaignDetailFormatter.Images = campaignImagesFormatter
+	return imagesFormatter
+}
+
+func FormatCampaignUpdate(campaignUpdate CampaignUpdate) CampaignUpdateFormatter {
+	formatter := CampaignUpdateFormatter{}
+	formatter.ID = campaignUpdate.ID
+	formatter.CampaignID = campaignUpdate.CampaignID
+	formatter.Title = campaignUpdate.Title
+	formatter.Body = campaignUpdate.Body
+	formatter.BackersOnly = campaignUpdate.BackersOnly
+	formatter.PublishedAt = campaignUpdate.PublishedAt
+	formatter.CreatedAt = campaignUpdate.CreatedAt
+	formatter.UpdatedAt = campaignUpdate.UpdatedAt
 
-	return campaignDetailFormatter
+	return formatter
+}
+
+func FormatCampaignUpdates(campaignUpdates []CampaignUpdate) []CampaignUpdateFormatter {
+	updatesFormatter := []CampaignUpdateFormatter{}
+
+	for _, campaignUpdate := range campaignUpdates {
+		updatesFormatter = append(updatesFormatter, FormatCampaignUpdate(campaignUpdate))
+	}
+
+	return updatesFormatter
+}
+
+func FormatRewardTier(rewardTier RewardTier) RewardTierFormatter {
+	formatter := RewardTierFormatter{}
+	formatter.ID = rewardTier.ID
+	formatter.Title = rewardTier.Title
+	formatter.Description = rewardTier.Description
+	formatter.MinimumAmount = rewardTier.MinimumAmount
+	formatter.QuantityLimit = rewardTier.QuantityLimit
+	formatter.ClaimedCount = rewardTier.ClaimedCount
+	formatter.IsSoldOut = rewardTier.IsSoldOut()
+	formatter.EstimatedDelivery = rewardTier.EstimatedDelivery
+	formatter.RequiresShipping = rewardTier.RequiresShipping
+
+	return formatter
+}
+
+func FormatCategory(category Category) CategoryFormatter {
+	formatter := CategoryFormatter{}
+	formatter.ID = category.ID
+	formatter.Name = category.Name
+	formatter.Slug = category.Slug
+	formatter.Description = category.Description
+
+	return formatter
+}
+
+func FormatCategories(categories []Category) []CategoryFormatter {
+	categoriesFormatter := []CategoryFormatter{}
+
+	for _, category := range categories {
+		categoriesFormatter = append(categoriesFormatter, FormatCategory(category))
+	}
+
+	return categoriesFormatter
+}
+
+func FormatTags(tags []Tag) []TagFormatter {
+	tagsFormatter := []TagFormatter{}
+
+	for _, tag := range tags {
+		tagsFormatter = append(tagsFormatter, TagFormatter{Name: tag.Name, Slug: tag.Slug})
+	}
+
+	return tagsFormatter
+}
+
+func formatCampaignCategory(category Category) *CategoryFormatter {
+	if category.ID == 0 {
+		return nil
+	}
+
+	formatter := FormatCategory(category)
+
+	return &formatter
+}
+
+// formatVariants maps each variant of an uploaded file to its URL. Files
+// uploaded before variants were made have none.
+func formatVariants(files storage.Backend, fileName string, names []string) map[string]string {
+	variants := map[string]string{}
+
+	for _, name := range names {
+		variants[name] = files.URL(upload.VariantKey(storage.Key(fileName), name))
+	}
+
+	return variants
 }
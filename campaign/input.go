@@ -1,22 +1,100 @@
 package campaign
 
-import "go_crowdfund/user"
+import (
+	"go_crowdfund/user"
+	"time"
+)
 
 type GetCampaignDetailInput struct {
 	ID int `uri:"id" binding:"required"`
 }
 
+type GetCampaignBySlugInput struct {
+	Slug string `uri:"slug" binding:"required"`
+}
+
+type GetCampaignsInput struct {
+	UserID    int      `form:"user_id" binding:"gte=0"`
+	Status    string   `form:"status"`
+	MinGoal   int      `form:"min_goal" binding:"gte=0"`
+	MaxGoal   int      `form:"max_goal" binding:"gte=0"`
+	MinFunded int      `form:"min_funded" binding:"gte=0"`
+	MaxFunded int      `form:"max_funded" binding:"gte=0"`
+	Category  string   `form:"category"`
+	Tags      []string `form:"tag"`
+	Featured  bool     `form:"featured"`
+	Sort      string   `form:"sort" binding:"omitempty,oneof=newest most_funded ending_soon most_backers relevance"`
+	Limit     int      `form:"limit" binding:"gte=0,lte=100"`
+	Cursor    string   `form:"cursor"`
+}
+
+type SearchCampaignsInput struct {
+	Query string `form:"q" binding:"required"`
+	GetCampaignsInput
+}
+
 type CreateCampaignInput struct {
-	Name             string `json:"name" binding:"required"`
-	ShortDescription string `json:"short_description" binding:"required"`
-	Description      string `json:"description" binding:"required"`
-	GoalAmount       int    `json:"goal_amount" binding:"required"`
-	Perks            string `json:"perks" binding:"required"`
+	Name             string            `json:"name" binding:"required"`
+	ShortDescription string            `json:"short_description" binding:"required"`
+	Description      string            `json:"description" binding:"required"`
+	GoalAmount       int               `json:"goal_amount" binding:"required"`
+	FundingModel     string            `json:"funding_model" binding:"omitempty,oneof=all_or_nothing keep_it_all"`
+	StartsAt         time.Time         `json:"starts_at" binding:"required"`
+	EndsAt           time.Time         `json:"ends_at" binding:"required,gtfield=StartsAt"`
+	CategoryID       int               `json:"category_id" binding:"gte=0"`
+	Tags             []string          `json:"tags" binding:"max=10,dive,required,max=30"`
+	RewardTiers      []RewardTierInput `json:"reward_tiers" binding:"dive"`
 	User             user.User
 }
 
+type GetRewardTierInput struct {
+	ID           int `uri:"id" binding:"required"`
+	RewardTierID int `uri:"rewardID" binding:"required"`
+}
+
+type RewardTierInput struct {
+	Title             string    `json:"title" binding:"required"`
+	Description       string    `json:"description"`
+	MinimumAmount     int       `json:"minimum_amount" binding:"required,gt=0"`
+	QuantityLimit     int       `json:"quantity_limit" binding:"gte=0"`
+	EstimatedDelivery time.Time `json:"estimated_delivery" binding:"required"`
+	RequiresShipping  bool      `json:"requires_shipping"`
+}
+
 type CreateCampaignImageInput struct {
 	CampaignID int  `form:"campaign_id" binding:"required"`
 	IsPrimary  bool `form:"is_primary"`
 	User       user.User
 }
+
+type GetCampaignImageInput struct {
+	ID      int `uri:"id" binding:"required"`
+	ImageID int `uri:"imageID" binding:"required"`
+}
+
+type ReorderImagesInput struct {
+	ImageIDs []int `json:"image_ids" binding:"required,min=1,dive,gt=0"`
+}
+
+type GetCampaignUpdateInput struct {
+	ID       int `uri:"id" binding:"required"`
+	UpdateID int `uri:"updateID" binding:"required"`
+}
+
+// CampaignUpdateInput leaves PublishedAt empty for a draft. A time in the
+// past publishes the update right away.
+type CampaignUpdateInput struct {
+	Title       string     `json:"title" binding:"required,max=255"`
+	Body        string     `json:"body" binding:"required"`
+	BackersOnly bool       `json:"backers_only"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+type GetCategoryInput struct {
+	Slug string `uri:"slug" binding:"required"`
+}
+
+type CategoryInput struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description"`
+}
@@ -1,15 +1,58 @@
 package campaign
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"go_crowdfund/user"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 type Repository interface {
-	FindAll() ([]Campaign, error)
-	FindByUserID(userID int) ([]Campaign, error)
+	FindAll(filter Filter) ([]Campaign, int64, error)
 	FindByID(ID int) (Campaign, error)
+	FindExpired(now time.Time) ([]Campaign, error)
+	FindBySlug(slug string) (Campaign, error)
+	FindCampaignIDBySlugHistory(slug string) (int, error)
+	IsSlugTaken(slug string, campaignID int) (bool, error)
+	ChangeSlug(campaign Campaign, newSlug string) (Campaign, error)
+	DeduplicateSlugs() error
 	Save(campaign Campaign) (Campaign, error)
 	Update(campaign Campaign) (Campaign, error)
+	UpdateStatus(ID int, from string, to string) (bool, error)
+	SetFeatured(ID int, featuredAt *time.Time) error
+	FindCategories() ([]Category, error)
+	FindCategoryBySlug(slug string) (Category, error)
+	FindCategoryByID(ID int) (Category, error)
+	SaveCategory(category Category) (Category, error)
+	UpdateCategory(category Category) (Category, error)
+	DeleteCategory(ID int) error
+	FindOrCreateTags(names []string) ([]Tag, error)
+	ReplaceTags(campaign Campaign, tags []Tag) error
+	FindRewardTierByID(ID int) (RewardTier, error)
+	SaveRewardTier(rewardTier RewardTier) (RewardTier, error)
+	UpdateRewardTier(rewardTier RewardTier) (RewardTier, error)
+	DeleteRewardTier(ID int) (bool, error)
+	MigratePerks() (int, error)
+	BackfillSchedules(now time.Time) (int64, error)
 	CreateImage(campaignImage CampaignImages) (CampaignImages, error)
-	MarkAllImagesAsNonPrimary(campaignID int) (bool, error)
+	SetPrimaryImage(campaignID int, imageID int) (bool, error)
+	ReorderImages(campaignID int, imageIDs []int) error
+	DeleteImage(campaignImage CampaignImages) error
+	FindCampaignUpdates(campaignID int, includeDrafts bool, now time.Time) ([]CampaignUpdate, error)
+	FindCampaignUpdateByID(ID int) (CampaignUpdate, error)
+	FindLatestCampaignUpdate(campaignID int, now time.Time) (CampaignUpdate, int64, error)
+	FindUnnotifiedCampaignUpdates(now time.Time, limit int) ([]CampaignUpdate, error)
+	SaveCampaignUpdate(campaignUpdate CampaignUpdate) (CampaignUpdate, error)
+	UpdateCampaignUpdate(campaignUpdate CampaignUpdate) (CampaignUpdate, error)
+	DeleteCampaignUpdate(ID int) error
+	MarkCampaignUpdateNotified(ID int, now time.Time) (bool, error)
+	IsBacker(campaignID int, userID int) (bool, error)
+	FindUpdateRecipients(campaignUpdate CampaignUpdate, maxAttempts int) ([]user.User, error)
+	RecordUpdateDelivery(delivery CampaignUpdateDelivery) error
 }
 
 type repository struct {
@@ -20,39 +63,151 @@ func NewRepository(db *gorm.DB) *repository {
 	return &repository{db}
 }
 
-func (r *repository) FindAll() ([]Campaign, error) {
+func (r *repository) FindAll(filter Filter) ([]Campaign, int64, error) {
 	var campaigns []Campaign
-	err := r.db.Preload("CampaignImages", "campaign_images.is_primary = 1").Find(&campaigns).Error
+	var total int64
+
+	err := r.db.Model(&Campaign{}).Scopes(filter.scope).Count(&total).Error
 
 	if err != nil {
-		return campaigns, err
+		return campaigns, total, err
 	}
 
-	return campaigns, nil
-}
+	query := r.db.Scopes(filter.scope, filter.order).Preload("CampaignImages", "campaign_images.is_primary = 1").Preload("Category").Preload("Tags")
 
-func (r *repository) FindByUserID(userID int) ([]Campaign, error) {
-	var campaigns []Campaign
-	err := r.db.Where("user_id = ?", userID).Preload("CampaignImages", "campaign_images.is_primary = 1").Find(&campaigns).Error
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	err = query.Find(&campaigns).Error
 
 	if err != nil {
-		return campaigns, err
+		return campaigns, total, err
 	}
 
-	return campaigns, nil
+	return campaigns, total, nil
 }
 
 func (r *repository) FindByID(ID int) (Campaign, error) {
 	var campaign Campaign
-	err := r.db.Preload("User").Preload("CampaignImages").Where("id = ?", ID).Find(&campaign).Error
+	err := r.db.Preload("User").Preload("CampaignImages", orderImages).Preload("Category").Preload("Tags").Preload("RewardTiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("reward_tiers.minimum_amount asc")
+	}).Where("id = ?", ID).Find(&campaign).Error
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return campaign, nil
+}
+
+func (r *repository) FindBySlug(slug string) (Campaign, error) {
+	var campaign Campaign
+	err := r.db.Where("slug = ?", slug).Find(&campaign).Error
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return campaign, nil
+}
+
+func (r *repository) FindCampaignIDBySlugHistory(slug string) (int, error) {
+	var campaignSlug CampaignSlug
+	err := r.db.Where("slug = ?", slug).Find(&campaignSlug).Error
+
+	if err != nil {
+		return 0, err
+	}
+
+	return campaignSlug.CampaignID, nil
+}
+
+// IsSlugTaken reports whether slug is used, now or in the past, by any
+// campaign other than campaignID.
+func (r *repository) IsSlugTaken(slug string, campaignID int) (bool, error) {
+	var count int64
+	err := r.db.Model(&Campaign{}).Where("slug = ? AND id <> ?", slug, campaignID).Count(&count).Error
+
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = r.db.Model(&CampaignSlug{}).Where("slug = ? AND campaign_id <> ?", slug, campaignID).Count(&count).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// ChangeSlug moves the campaign to newSlug and keeps its current slug in the
+// history, in a single DB transaction.
+func (r *repository) ChangeSlug(campaign Campaign, newSlug string) (Campaign, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("campaign_id = ? AND slug = ?", campaign.ID, newSlug).Delete(&CampaignSlug{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&CampaignSlug{CampaignID: campaign.ID, Slug: campaign.Slug}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&Campaign{}).Where("id = ?", campaign.ID).Update("slug", newSlug).Error
+	})
 
 	if err != nil {
 		return campaign, err
 	}
 
+	campaign.Slug = newSlug
+
 	return campaign, nil
 }
 
+// DeduplicateSlugs suffixes every campaign that shares its slug with an older
+// campaign with its ID. It runs before the unique index on slug is created.
+func (r *repository) DeduplicateSlugs() error {
+	if !r.db.Migrator().HasTable(&Campaign{}) {
+		return nil
+	}
+
+	var duplicates []Campaign
+	err := r.db.Select("id", "slug").
+		Where("EXISTS (SELECT 1 FROM (SELECT id, slug FROM campaigns) AS older WHERE older.slug = campaigns.slug AND older.id < campaigns.id)").
+		Find(&duplicates).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range duplicates {
+		err := r.db.Model(&Campaign{}).Where("id = ?", campaign.ID).Update("slug", fmt.Sprintf("%s-%d", campaign.Slug, campaign.ID)).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *repository) FindExpired(now time.Time) ([]Campaign, error) {
+	var campaigns []Campaign
+	err := r.db.Where("status = ? AND ends_at <= ?", StatusLive, now).Find(&campaigns).Error
+
+	if err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
 func (r *repository) Save(campaign Campaign) (Campaign, error) {
 	err := r.db.Create(&campaign).Error
 
@@ -63,8 +218,10 @@ func (r *repository) Save(campaign Campaign) (Campaign, error) {
 	return campaign, nil
 }
 
+// Update never writes the funding counters, the status or the slug: those are
+// changed concurrently by payments, by UpdateStatus and by ChangeSlug.
 func (r *repository) Update(campaign Campaign) (Campaign, error) {
-	err := r.db.Save(&campaign).Error
+	err := r.db.Omit("CurrentAmount", "BackerCount", "Status", "Slug", "FeaturedAt", "RewardTiers", "Category", "Tags").Save(&campaign).Error
 
 	if err != nil {
 		return campaign, err
@@ -73,8 +230,278 @@ func (r *repository) Update(campaign Campaign) (Campaign, error) {
 	return campaign, nil
 }
 
+func (r *repository) SetFeatured(ID int, featuredAt *time.Time) error {
+	return r.db.Model(&Campaign{}).Where("id = ?", ID).Update("featured_at", featuredAt).Error
+}
+
+func (r *repository) UpdateStatus(ID int, from string, to string) (bool, error) {
+	result := r.db.Model(&Campaign{}).Where("id = ? AND status = ?", ID, from).Update("status", to)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *repository) FindCategories() ([]Category, error) {
+	var categories []Category
+	err := r.db.Order("name asc").Find(&categories).Error
+
+	if err != nil {
+		return categories, err
+	}
+
+	return categories, nil
+}
+
+func (r *repository) FindCategoryBySlug(slug string) (Category, error) {
+	var category Category
+	err := r.db.Where("slug = ?", slug).Find(&category).Error
+
+	if err != nil {
+		return category, err
+	}
+
+	return category, nil
+}
+
+func (r *repository) FindCategoryByID(ID int) (Category, error) {
+	var category Category
+	err := r.db.Where("id = ?", ID).Find(&category).Error
+
+	if err != nil {
+		return category, err
+	}
+
+	return category, nil
+}
+
+func (r *repository) SaveCategory(category Category) (Category, error) {
+	err := r.db.Create(&category).Error
+
+	if err != nil {
+		return category, err
+	}
+
+	return category, nil
+}
+
+func (r *repository) UpdateCategory(category Category) (Category, error) {
+	err := r.db.Save(&category).Error
+
+	if err != nil {
+		return category, err
+	}
+
+	return category, nil
+}
+
+// DeleteCategory removes the category and detaches its campaigns in the same
+// DB transaction.
+func (r *repository) DeleteCategory(ID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Campaign{}).Where("category_id = ?", ID).Update("category_id", 0).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", ID).Delete(&Category{}).Error
+	})
+}
+
+// FindOrCreateTags returns the tags for names, creating the ones that do not
+// exist yet. Names that slugify to the same value share one tag.
+func (r *repository) FindOrCreateTags(names []string) ([]Tag, error) {
+	tags := []Tag{}
+	slugs := []string{}
+
+	for _, name := range names {
+		tag := Tag{Name: strings.TrimSpace(name), Slug: slug.Make(name)}
+
+		if tag.Slug == "" {
+			continue
+		}
+
+		tags = append(tags, tag)
+		slugs = append(slugs, tag.Slug)
+	}
+
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []Tag
+	err = r.db.Where("slug IN ?", slugs).Find(&saved).Error
+
+	if err != nil {
+		return saved, err
+	}
+
+	return saved, nil
+}
+
+func (r *repository) ReplaceTags(campaign Campaign, tags []Tag) error {
+	return r.db.Model(&campaign).Association("Tags").Replace(tags)
+}
+
+func (r *repository) FindRewardTierByID(ID int) (RewardTier, error) {
+	var rewardTier RewardTier
+	err := r.db.Where("id = ?", ID).Find(&rewardTier).Error
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	return rewardTier, nil
+}
+
+func (r *repository) SaveRewardTier(rewardTier RewardTier) (RewardTier, error) {
+	err := r.db.Create(&rewardTier).Error
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	return rewardTier, nil
+}
+
+func (r *repository) UpdateRewardTier(rewardTier RewardTier) (RewardTier, error) {
+	err := r.db.Omit("ClaimedCount").Save(&rewardTier).Error
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	return rewardTier, nil
+}
+
+func (r *repository) DeleteRewardTier(ID int) (bool, error) {
+	result := r.db.Where("id = ? AND claimed_count = 0", ID).Delete(&RewardTier{})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// MigratePerks turns the legacy comma-separated Perks of campaigns that have
+// no reward tiers yet into one tier per perk.
+func (r *repository) MigratePerks() (int, error) {
+	var campaigns []Campaign
+	err := r.db.Where("perks <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM reward_tiers WHERE reward_tiers.campaign_id = campaigns.id)").
+		Find(&campaigns).Error
+
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+
+	for _, campaign := range campaigns {
+		rewardTiers := []RewardTier{}
+
+		for _, perk := range strings.Split(campaign.Perks, ",") {
+			perk = strings.TrimSpace(perk)
+
+			if perk == "" {
+				continue
+			}
+
+			rewardTiers = append(rewardTiers, RewardTier{
+				CampaignID:        campaign.ID,
+				Title:             perk,
+				EstimatedDelivery: campaign.EndsAt,
+			})
+		}
+
+		if len(rewardTiers) == 0 {
+			continue
+		}
+
+		err := r.db.Create(&rewardTiers).Error
+
+		if err != nil {
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// BackfillSchedules gives campaigns created before they had a schedule, whose
+// ends_at is still empty, one starting when they were created and ending a
+// full campaign duration from now. They become keep-it-all, since their
+// backers never pledged on all-or-nothing terms and must not be refunded
+// because of a deadline they were never given.
+func (r *repository) BackfillSchedules(now time.Time) (int64, error) {
+	result := r.db.Model(&Campaign{}).
+		Where("ends_at IS NULL OR ends_at < ?", time.Unix(86400, 0)).
+		Updates(map[string]interface{}{
+			"starts_at":     gorm.Expr("created_at"),
+			"ends_at":       now.Add(MaxCampaignDuration),
+			"funding_model": FundingKeepItAll,
+		})
+
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// CreateImage adds the image after the campaign's other images. It becomes
+// the primary image when asked to, clearing the previous one, or when the
+// campaign has none yet.
 func (r *repository) CreateImage(campaignImage CampaignImages) (CampaignImages, error) {
-	err := r.db.Create(&campaignImage).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := lockCampaign(tx, campaignImage.CampaignID)
+
+		if err != nil {
+			return err
+		}
+
+		var last struct {
+			Position   int
+			HasPrimary int
+		}
+
+		err = tx.Model(&CampaignImages{}).
+			Select("COALESCE(MAX(position), 0) AS position, COALESCE(MAX(is_primary), 0) AS has_primary").
+			Where("campaign_id = ?", campaignImage.CampaignID).
+			Scan(&last).Error
+
+		if err != nil {
+			return err
+		}
+
+		if last.HasPrimary == 0 {
+			campaignImage.IsPrimary = 1
+		}
+
+		if campaignImage.IsPrimary == 1 {
+			err := tx.Model(&CampaignImages{}).Where("campaign_id = ?", campaignImage.CampaignID).Update("is_primary", 0).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		campaignImage.Position = last.Position + 1
+
+		return tx.Create(&campaignImage).Error
+	})
 
 	if err != nil {
 		return campaignImage, err
@@ -83,13 +510,263 @@ func (r *repository) CreateImage(campaignImage CampaignImages) (CampaignImages,
 	return campaignImage, nil
 }
 
-func (r *repository) MarkAllImagesAsNonPrimary(campaignID int) (bool, error) {
+// SetPrimaryImage makes the image the campaign's only primary image. It
+// reports false, changing nothing, when the image is not the campaign's.
+func (r *repository) SetPrimaryImage(campaignID int, imageID int) (bool, error) {
+	found := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := lockCampaign(tx, campaignID)
 
-	err := r.db.Model(&CampaignImages{}).Where("campaign_id = ?", campaignID).Update("is_primary", false).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&CampaignImages{}).Where("id = ? AND campaign_id = ?", imageID, campaignID).Update("is_primary", 1)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		found = result.RowsAffected > 0
+
+		if !found {
+			return nil
+		}
+
+		return tx.Model(&CampaignImages{}).Where("campaign_id = ? AND id <> ?", campaignID, imageID).Update("is_primary", 0).Error
+	})
 
 	if err != nil {
 		return false, err
 	}
 
-	return true, nil
+	return found, nil
+}
+
+// ReorderImages numbers the campaign's images in the order of imageIDs.
+func (r *repository) ReorderImages(campaignID int, imageIDs []int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := lockCampaign(tx, campaignID)
+
+		if err != nil {
+			return err
+		}
+
+		for i, imageID := range imageIDs {
+			err := tx.Model(&CampaignImages{}).Where("id = ? AND campaign_id = ?", imageID, campaignID).Update("position", i+1).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteImage removes the image. When it was the primary image, the next
+// one in order takes its place. Whether it was is read again under the lock,
+// since SetPrimaryImage may have changed it since the caller loaded it.
+func (r *repository) DeleteImage(campaignImage CampaignImages) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := lockCampaign(tx, campaignImage.CampaignID)
+
+		if err != nil {
+			return err
+		}
+
+		var current CampaignImages
+		err = tx.Where("id = ? AND campaign_id = ?", campaignImage.ID, campaignImage.CampaignID).Find(&current).Error
+
+		if err != nil || current.ID == 0 {
+			return err
+		}
+
+		err = tx.Delete(&CampaignImages{}, current.ID).Error
+
+		if err != nil {
+			return err
+		}
+
+		if current.IsPrimary != 1 {
+			return nil
+		}
+
+		var next CampaignImages
+		err = orderImages(tx.Where("campaign_id = ?", campaignImage.CampaignID)).Limit(1).Find(&next).Error
+
+		if err != nil || next.ID == 0 {
+			return err
+		}
+
+		return tx.Model(&next).Update("is_primary", 1).Error
+	})
+}
+
+// lockCampaign locks the campaign's row for the rest of the transaction.
+// Changes to a campaign's images take it first, so concurrent ones cannot
+// both read the same position or both leave an image primary.
+func lockCampaign(tx *gorm.DB, campaignID int) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", campaignID).Find(&Campaign{}).Error
+}
+
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// FindCampaignUpdates returns the published updates, newest first, preceded
+// by drafts and scheduled ones when includeDrafts is set.
+func (r *repository) FindCampaignUpdates(campaignID int, includeDrafts bool, now time.Time) ([]CampaignUpdate, error) {
+	var campaignUpdates []CampaignUpdate
+	query := r.db.Where("campaign_id = ?", campaignID)
+
+	if !includeDrafts {
+		query = query.Where("published_at <= ?", now)
+	}
+
+	err := query.Order("published_at IS NULL DESC, published_at DESC, id DESC").Find(&campaignUpdates).Error
+
+	if err != nil {
+		return campaignUpdates, err
+	}
+
+	return campaignUpdates, nil
+}
+
+func (r *repository) FindCampaignUpdateByID(ID int) (CampaignUpdate, error) {
+	var campaignUpdate CampaignUpdate
+	err := r.db.Where("id = ?", ID).Find(&campaignUpdate).Error
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	return campaignUpdate, nil
+}
+
+// FindLatestCampaignUpdate returns the most recently published update and the
+// number of published updates.
+func (r *repository) FindLatestCampaignUpdate(campaignID int, now time.Time) (CampaignUpdate, int64, error) {
+	var campaignUpdate CampaignUpdate
+	var count int64
+
+	query := r.db.Model(&CampaignUpdate{}).Where("campaign_id = ? AND published_at <= ?", campaignID, now)
+	err := query.Count(&count).Error
+
+	if err != nil || count == 0 {
+		return campaignUpdate, count, err
+	}
+
+	err = r.db.Where("campaign_id = ? AND published_at <= ?", campaignID, now).
+		Order("published_at DESC, id DESC").Limit(1).Find(&campaignUpdate).Error
+
+	if err != nil {
+		return campaignUpdate, count, err
+	}
+
+	return campaignUpdate, count, nil
+}
+
+func (r *repository) FindUnnotifiedCampaignUpdates(now time.Time, limit int) ([]CampaignUpdate, error) {
+	var campaignUpdates []CampaignUpdate
+	err := r.db.Where("published_at <= ? AND notified_at IS NULL", now).Order("published_at, id").Limit(limit).Find(&campaignUpdates).Error
+
+	if err != nil {
+		return campaignUpdates, err
+	}
+
+	return campaignUpdates, nil
+}
+
+func (r *repository) SaveCampaignUpdate(campaignUpdate CampaignUpdate) (CampaignUpdate, error) {
+	err := r.db.Create(&campaignUpdate).Error
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	return campaignUpdate, nil
+}
+
+func (r *repository) UpdateCampaignUpdate(campaignUpdate CampaignUpdate) (CampaignUpdate, error) {
+	err := r.db.Omit("NotifiedAt").Save(&campaignUpdate).Error
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	return campaignUpdate, nil
+}
+
+func (r *repository) DeleteCampaignUpdate(ID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("campaign_update_id = ?", ID).Delete(&CampaignUpdateDelivery{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", ID).Delete(&CampaignUpdate{}).Error
+	})
+}
+
+// MarkCampaignUpdateNotified reports false when the update was already
+// marked, or has been deleted in the meantime.
+func (r *repository) MarkCampaignUpdateNotified(ID int, now time.Time) (bool, error) {
+	result := r.db.Model(&CampaignUpdate{}).Where("id = ? AND notified_at IS NULL", ID).Update("notified_at", now)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// backerStatus is the status of pledges that make their user a backer.
+const backerStatus = "paid"
+
+// IsBacker reports whether the user has a paid pledge on the campaign.
+// Pledges live in the transaction package, which depends on this one, so
+// the table is queried directly.
+func (r *repository) IsBacker(campaignID int, userID int) (bool, error) {
+	var count int64
+	err := r.db.Table("transactions").Where("campaign_id = ? AND user_id = ? AND status = ?", campaignID, userID, backerStatus).Count(&count).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// FindUpdateRecipients returns the backers still owed the update: those it
+// has neither been sent to nor failed to reach maxAttempts times.
+func (r *repository) FindUpdateRecipients(campaignUpdate CampaignUpdate, maxAttempts int) ([]user.User, error) {
+	var recipients []user.User
+	err := r.db.Where("id IN (?)", r.db.Table("transactions").Select("user_id").Where("campaign_id = ? AND status = ?", campaignUpdate.CampaignID, backerStatus)).
+		Where("id NOT IN (?)", r.db.Model(&CampaignUpdateDelivery{}).Select("user_id").Where("campaign_update_id = ? AND (sent_at IS NOT NULL OR attempts >= ?)", campaignUpdate.ID, maxAttempts)).
+		Order("id").
+		Find(&recipients).Error
+
+	if err != nil {
+		return recipients, err
+	}
+
+	return recipients, nil
+}
+
+// RecordUpdateDelivery adds the attempt to the backer's delivery of the
+// update, creating it on the first attempt.
+func (r *repository) RecordUpdateDelivery(delivery CampaignUpdateDelivery) error {
+	delivery.Attempts = 1
+
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": delivery.LastError,
+			"sent_at":    delivery.SentAt,
+			"updated_at": time.Now(),
+		}),
+	}).Create(&delivery).Error
 }
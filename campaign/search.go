@@ -0,0 +1,21 @@
+package campaign
+
+type SearchHit struct {
+	CampaignID int
+	Score      float64
+	Highlights map[string]string
+}
+
+// SearchIndex is the full-text search backend for campaigns. Backends that
+// read straight from the campaigns table can treat Index and Remove as no-ops.
+type SearchIndex interface {
+	Index(campaign Campaign) error
+	Remove(campaignID int) error
+	Search(query string, limit int) ([]SearchHit, error)
+}
+
+type SearchResult struct {
+	Campaign   Campaign
+	Score      float64
+	Highlights map[string]string
+}
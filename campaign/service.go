@@ -3,93 +3,388 @@ package campaign
 import (
 	"errors"
 	"fmt"
+	"go_crowdfund/helper"
+	"go_crowdfund/mailer"
+	"go_crowdfund/policy"
+	"go_crowdfund/user"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gosimple/slug"
 )
 
+// ErrNotFound is returned for a campaign that does not exist, or that the
+// viewer may not see.
+var ErrNotFound = errors.New("No campaign found with that ID")
+
+const (
+	MaxCampaignDuration = 90 * 24 * time.Hour
+	MaxSearchHits       = 500
+	MaxUpdateAttempts   = 5
+)
+
 type Service interface {
-	GetCampaigns(userID int) ([]Campaign, error)
-	GetCampaign(input GetCampaignDetailInput) (Campaign, error)
+	GetCampaigns(input GetCampaignsInput, viewer user.User) ([]Campaign, helper.Pagination, error)
+	SearchCampaigns(input SearchCampaignsInput, viewer user.User) ([]SearchResult, helper.Pagination, error)
+	GetCampaign(input GetCampaignDetailInput, viewer user.User) (Campaign, error)
+	GetCampaignBySlug(input GetCampaignBySlugInput, viewer user.User) (Campaign, bool, error)
 	CreateCampaign(input CreateCampaignInput) (Campaign, error)
 	UpdateCampaign(ID GetCampaignDetailInput, inputData CreateCampaignInput) (Campaign, error)
-	SaveCampaignImage(input CreateCampaignImageInput, fileLocation string) (CampaignImages, error)
+	AuthorizeImageUpload(input CreateCampaignImageInput) error
+	SaveCampaignImage(input CreateCampaignImageInput, fileLocation string, variants []string) (CampaignImages, error)
+	SubmitCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error)
+	ApproveCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error)
+	RejectCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error)
+	CancelCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error)
+	FeatureCampaign(input GetCampaignDetailInput, featured bool, currentUser user.User) (Campaign, error)
+	TakeDownCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error)
+	CloseCampaign(campaign Campaign) (Campaign, error)
+	CloseExpiredCampaigns(now time.Time) (int, error)
+	GetCategories() ([]Category, error)
+	GetCategoryCampaigns(input GetCategoryInput, listing GetCampaignsInput, viewer user.User) (Category, []Campaign, helper.Pagination, error)
+	CreateCategory(input CategoryInput, currentUser user.User) (Category, error)
+	UpdateCategory(input GetCategoryInput, inputData CategoryInput, currentUser user.User) (Category, error)
+	DeleteCategory(input GetCategoryInput, currentUser user.User) error
+	CreateRewardTier(input GetCampaignDetailInput, inputData RewardTierInput, currentUser user.User) (RewardTier, error)
+	UpdateRewardTier(input GetRewardTierInput, inputData RewardTierInput, currentUser user.User) (RewardTier, error)
+	DeleteRewardTier(input GetRewardTierInput, currentUser user.User) error
+	GetCampaignImages(input GetCampaignDetailInput, viewer user.User) ([]CampaignImages, error)
+	GetCampaignImage(input GetCampaignImageInput, viewer user.User) (CampaignImages, error)
+	SetPrimaryImage(input GetCampaignImageInput, currentUser user.User) (CampaignImages, error)
+	ReorderImages(input GetCampaignDetailInput, inputData ReorderImagesInput, currentUser user.User) ([]CampaignImages, error)
+	DeleteCampaignImage(input GetCampaignImageInput, currentUser user.User) (CampaignImages, error)
+	GetCampaignUpdates(input GetCampaignDetailInput, viewer user.User) ([]CampaignUpdate, error)
+	GetCampaignUpdate(input GetCampaignUpdateInput, viewer user.User) (CampaignUpdate, error)
+	CreateCampaignUpdate(input GetCampaignDetailInput, inputData CampaignUpdateInput, currentUser user.User) (CampaignUpdate, error)
+	UpdateCampaignUpdate(input GetCampaignUpdateInput, inputData CampaignUpdateInput, currentUser user.User) (CampaignUpdate, error)
+	DeleteCampaignUpdate(input GetCampaignUpdateInput, currentUser user.User) error
+	NotifyBackers(now time.Time, limit int) (int, error)
 }
 
 type service struct {
-	repository Repository
+	repository  Repository
+	searchIndex SearchIndex
+	mailer      mailer.Mailer
+}
+
+func NewService(repository Repository, searchIndex SearchIndex, mailer mailer.Mailer) *service {
+	return &service{repository, searchIndex, mailer}
+}
+
+func (s *service) GetCampaigns(input GetCampaignsInput, viewer user.User) ([]Campaign, helper.Pagination, error) {
+	filter, err := NewFilter(input, viewer)
+
+	if err != nil {
+		return []Campaign{}, helper.Pagination{}, err
+	}
+
+	campaigns, total, err := s.repository.FindAll(filter)
+
+	if err != nil {
+		return campaigns, helper.Pagination{}, err
+	}
+
+	return campaigns, helper.NewPagination(total, filter.Offset, filter.Limit), nil
 }
 
-func NewService(repository Repository) *service {
-	return &service{repository}
+// SearchCampaigns ranks campaigns with the search index and then applies the
+// listing filters in SQL to the best MaxSearchHits matches. Results keep the
+// relevance order unless another sort is requested.
+func (s *service) SearchCampaigns(input SearchCampaignsInput, viewer user.User) ([]SearchResult, helper.Pagination, error) {
+	filter, err := NewFilter(input.GetCampaignsInput, viewer)
+
+	if err != nil {
+		return []SearchResult{}, helper.Pagination{}, err
+	}
+
+	hits, err := s.searchIndex.Search(input.Query, MaxSearchHits)
+
+	if err != nil {
+		return []SearchResult{}, helper.Pagination{}, err
+	}
+
+	hitsByID := map[int]SearchHit{}
+	filter.IDs = []int{}
+
+	for _, hit := range hits {
+		hitsByID[hit.CampaignID] = hit
+		filter.IDs = append(filter.IDs, hit.CampaignID)
+	}
+
+	if len(filter.IDs) == 0 {
+		return []SearchResult{}, helper.NewPagination(0, filter.Offset, filter.Limit), nil
+	}
+
+	offset, limit := filter.Offset, filter.Limit
+	filter.Offset, filter.Limit = 0, 0
+
+	campaigns, total, err := s.repository.FindAll(filter)
+
+	if err != nil {
+		return []SearchResult{}, helper.Pagination{}, err
+	}
+
+	results := []SearchResult{}
+	for _, campaign := range campaigns {
+		hit := hitsByID[campaign.ID]
+		results = append(results, SearchResult{Campaign: campaign, Score: hit.Score, Highlights: hit.Highlights})
+	}
+
+	if input.Sort == "" || input.Sort == SortRelevance {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+	}
+
+	if offset > len(results) {
+		offset = len(results)
+	}
+
+	end := offset + limit
+	if end > len(results) {
+		end = len(results)
+	}
+
+	return results[offset:end], helper.NewPagination(total, offset, limit), nil
 }
 
-func (s *service) GetCampaigns(userID int) ([]Campaign, error) {
-	if userID != 0 {
-		campaign, err := s.repository.FindByUserID(userID)
+// GetCampaign also summarises the campaign's published updates.
+func (s *service) GetCampaign(input GetCampaignDetailInput, viewer user.User) (Campaign, error) {
+	campaign, err := s.findVisible(input.ID, viewer)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	latest, count, err := s.repository.FindLatestCampaignUpdate(campaign.ID, time.Now())
+
+	if err != nil {
+		return campaign, err
+	}
+
+	campaign.UpdateCount = count
+
+	if count > 0 {
+		updates, err := s.hideBackersOnly(campaign, []CampaignUpdate{latest}, viewer)
 
 		if err != nil {
 			return campaign, err
 		}
 
-		return campaign, nil
+		campaign.LatestUpdate = &updates[0]
 	}
 
-	campaign, err := s.repository.FindAll()
+	return campaign, nil
+}
+
+// findCampaign finds a campaign by ID, failing with ErrNotFound before any
+// policy check so admins cannot act on, and save, a campaign that is not
+// there.
+func (s *service) findCampaign(ID int) (Campaign, error) {
+	campaign, err := s.repository.FindByID(ID)
 
 	if err != nil {
 		return campaign, err
 	}
 
+	if campaign.ID == 0 {
+		return campaign, ErrNotFound
+	}
+
 	return campaign, nil
 }
 
-func (s *service) GetCampaign(input GetCampaignDetailInput) (Campaign, error) {
-	campaign, err := s.repository.FindByID(input.ID)
+// findVisible finds a campaign the viewer may see: a public one, or one of
+// their own.
+func (s *service) findVisible(ID int, viewer user.User) (Campaign, error) {
+	campaign, err := s.repository.FindByID(ID)
 
 	if err != nil {
 		return campaign, err
 	}
 
+	if campaign.ID == 0 || (!IsPublic(campaign.Status) && !policy.CanOnOwned(viewer, policy.CampaignView, campaign.UserID)) {
+		return Campaign{}, ErrNotFound
+	}
+
 	return campaign, nil
 }
 
+// GetCampaignBySlug also resolves slugs the campaign had before a rename, in
+// which case the returned flag is true and campaign.Slug is the current slug.
+func (s *service) GetCampaignBySlug(input GetCampaignBySlugInput, viewer user.User) (Campaign, bool, error) {
+	campaign, err := s.repository.FindBySlug(input.Slug)
+
+	if err != nil {
+		return campaign, false, err
+	}
+
+	moved := false
+
+	if campaign.ID == 0 {
+		campaignID, err := s.repository.FindCampaignIDBySlugHistory(input.Slug)
+
+		if err != nil {
+			return Campaign{}, false, err
+		}
+
+		if campaignID == 0 {
+			return Campaign{}, false, errors.New("No campaign found with that slug")
+		}
+
+		campaign.ID = campaignID
+		moved = true
+	}
+
+	campaign, err = s.GetCampaign(GetCampaignDetailInput{ID: campaign.ID}, viewer)
+
+	if err != nil {
+		return campaign, false, err
+	}
+
+	return campaign, moved, nil
+}
+
 func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
+	err := policy.Authorize(input.User, policy.CampaignCreate)
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	err = validateSchedule(input.StartsAt, input.EndsAt, time.Now())
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
 	campaign := Campaign{}
 	campaign.Name = input.Name
 	campaign.ShortDescription = input.ShortDescription
 	campaign.Description = input.Description
 	campaign.GoalAmount = input.GoalAmount
-	campaign.Perks = input.Perks
 	campaign.UserID = input.User.ID
+	campaign.Status = StatusDraft
+	campaign.FundingModel = FundingAllOrNothing
+
+	if input.FundingModel != "" {
+		campaign.FundingModel = input.FundingModel
+	}
+	campaign.StartsAt = input.StartsAt
+	campaign.EndsAt = input.EndsAt
+
+	err = s.checkCategory(input.CategoryID)
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	campaign.CategoryID = input.CategoryID
+
+	campaign.Tags, err = s.repository.FindOrCreateTags(input.Tags)
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	for _, rewardTierInput := range input.RewardTiers {
+		rewardTier, err := newRewardTier(rewardTierInput, campaign)
+
+		if err != nil {
+			return Campaign{}, err
+		}
+
+		campaign.RewardTiers = append(campaign.RewardTiers, rewardTier)
+	}
+
+	campaign.Slug, err = s.uniqueSlug(input.Name, input.User.ID, 0)
 
-	stringSlug := fmt.Sprintf("%s %d", input.Name, input.User.ID)
-	campaign.Slug = slug.Make(stringSlug)
+	if err != nil {
+		return Campaign{}, err
+	}
 
 	saveCampaign, err := s.repository.Save(campaign)
 	if err != nil {
 		return saveCampaign, err
 	}
 
+	err = s.searchIndex.Index(saveCampaign)
+	if err != nil {
+		return saveCampaign, err
+	}
+
 	return saveCampaign, nil
 
 }
 
 func (s *service) UpdateCampaign(inputID GetCampaignDetailInput, InputData CreateCampaignInput) (Campaign, error) {
-	campaign, err := s.repository.FindByID(inputID.ID)
+	campaign, err := s.findCampaign(inputID.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.AuthorizeOwned(InputData.User, policy.CampaignUpdate, campaign.UserID)
 
 	if err != nil {
 		return campaign, err
 	}
 
-	if campaign.UserID != InputData.User.ID {
-		return campaign, errors.New("not an owner of the campaign")
+	if IsClosed(campaign.Status) {
+		return campaign, errors.New("campaign is already closed")
+	}
+
+	if !campaign.StartsAt.Equal(InputData.StartsAt) || !campaign.EndsAt.Equal(InputData.EndsAt) {
+		if campaign.Status == StatusLive {
+			return campaign, errors.New("cannot change the schedule of a live campaign")
+		}
+
+		err = validateSchedule(InputData.StartsAt, InputData.EndsAt, time.Now())
+
+		if err != nil {
+			return campaign, err
+		}
+
+		campaign.StartsAt = InputData.StartsAt
+		campaign.EndsAt = InputData.EndsAt
 	}
 
+	nameChanged := campaign.Name != InputData.Name
+
 	campaign.Name = InputData.Name
 	campaign.ShortDescription = InputData.ShortDescription
 	campaign.Description = InputData.Description
-	campaign.Perks = InputData.Perks
-	campaign.GoalAmount = InputData.GoalAmount
+
+	if InputData.GoalAmount != campaign.GoalAmount {
+		if campaign.Status == StatusLive {
+			return campaign, errors.New("cannot change the goal of a live campaign")
+		}
+
+		campaign.GoalAmount = InputData.GoalAmount
+	}
+
+	if InputData.FundingModel != "" && InputData.FundingModel != campaign.FundingModel {
+		if campaign.Status == StatusLive {
+			return campaign, errors.New("cannot change the funding model of a live campaign")
+		}
+
+		campaign.FundingModel = InputData.FundingModel
+	}
+
+	err = s.checkCategory(InputData.CategoryID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	campaign.CategoryID = InputData.CategoryID
+
+	tags, err := s.repository.FindOrCreateTags(InputData.Tags)
+
+	if err != nil {
+		return campaign, err
+	}
 
 	updateCampaign, err := s.repository.Update(campaign)
 
@@ -97,28 +392,68 @@ func (s *service) UpdateCampaign(inputID GetCampaignDetailInput, InputData Creat
 		return updateCampaign, err
 	}
 
+	err = s.repository.ReplaceTags(updateCampaign, tags)
+
+	if err != nil {
+		return updateCampaign, err
+	}
+
+	if nameChanged {
+		newSlug, err := s.uniqueSlug(updateCampaign.Name, updateCampaign.UserID, updateCampaign.ID)
+
+		if err != nil {
+			return updateCampaign, err
+		}
+
+		if newSlug != updateCampaign.Slug {
+			updateCampaign, err = s.repository.ChangeSlug(updateCampaign, newSlug)
+
+			if err != nil {
+				return updateCampaign, err
+			}
+		}
+	}
+
+	updateCampaign.Tags = tags
+
+	err = s.searchIndex.Index(updateCampaign)
+
+	if err != nil {
+		return updateCampaign, err
+	}
+
 	return updateCampaign, nil
 }
 
-func (s *service) SaveCampaignImage(input CreateCampaignImageInput, fileLocation string) (CampaignImages, error) {
-	campaign, err := s.repository.FindByID(input.CampaignID)
+// AuthorizeImageUpload lets handlers check that the user may add images to
+// the campaign before the file is processed and stored.
+func (s *service) AuthorizeImageUpload(input CreateCampaignImageInput) error {
+	campaign, err := s.findCampaign(input.CampaignID)
+
+	if err != nil {
+		return err
+	}
+
+	return policy.AuthorizeOwned(input.User, policy.CampaignUpdate, campaign.UserID)
+}
+
+func (s *service) SaveCampaignImage(input CreateCampaignImageInput, fileLocation string, variants []string) (CampaignImages, error) {
+	campaign, err := s.findCampaign(input.CampaignID)
 
 	if err != nil {
 		return CampaignImages{}, err
 	}
 
-	if campaign.UserID != input.User.ID {
-		return CampaignImages{}, errors.New("not an owner of the campaign")
+	err = policy.AuthorizeOwned(input.User, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return CampaignImages{}, err
 	}
 
 	isPrimary := 0
 
 	if input.IsPrimary {
 		isPrimary = 1
-		_, err := s.repository.MarkAllImagesAsNonPrimary(input.CampaignID)
-		if err != nil {
-			return CampaignImages{}, err
-		}
 	}
 
 	campaignImage := CampaignImages{}
@@ -126,6 +461,7 @@ func (s *service) SaveCampaignImage(input CreateCampaignImageInput, fileLocation
 	campaignImage.CampaignID = input.CampaignID
 	campaignImage.IsPrimary = isPrimary
 	campaignImage.FileName = fileLocation
+	campaignImage.Variants = strings.Join(variants, ",")
 
 	createImage, err := s.repository.CreateImage(campaignImage)
 
@@ -135,3 +471,922 @@ func (s *service) SaveCampaignImage(input CreateCampaignImageInput, fileLocation
 
 	return createImage, nil
 }
+
+func (s *service) SubmitCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignSubmit, campaign.UserID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return s.transition(campaign, StatusInReview)
+}
+
+func (s *service) ApproveCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.Authorize(currentUser, policy.CampaignApprove)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	if !campaign.EndsAt.After(time.Now()) {
+		return campaign, errors.New("campaign deadline has already passed")
+	}
+
+	return s.transition(campaign, StatusLive)
+}
+
+func (s *service) RejectCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.Authorize(currentUser, policy.CampaignReject)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return s.transition(campaign, StatusDraft)
+}
+
+func (s *service) CancelCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignCancel, campaign.UserID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return s.transition(campaign, StatusCancelled)
+}
+
+func (s *service) FeatureCampaign(input GetCampaignDetailInput, featured bool, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.Authorize(currentUser, policy.CampaignFeature)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	var featuredAt *time.Time
+
+	if featured {
+		if !IsPublic(campaign.Status) {
+			return campaign, errors.New("only public campaigns can be featured")
+		}
+
+		now := time.Now()
+		featuredAt = &now
+	}
+
+	err = s.repository.SetFeatured(campaign.ID, featuredAt)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	campaign.FeaturedAt = featuredAt
+
+	return campaign, nil
+}
+
+// TakeDownCampaign hides a campaign that breaks the rules, whatever state it
+// is in. Paid pledges on it are refunded.
+func (s *service) TakeDownCampaign(input GetCampaignDetailInput, currentUser user.User) (Campaign, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	err = policy.Authorize(currentUser, policy.CampaignTakeDown)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	takenDown, err := s.transition(campaign, StatusTakenDown)
+
+	if err != nil {
+		return takenDown, err
+	}
+
+	if takenDown.FeaturedAt != nil {
+		err = s.repository.SetFeatured(takenDown.ID, nil)
+
+		if err != nil {
+			return takenDown, err
+		}
+
+		takenDown.FeaturedAt = nil
+	}
+
+	return takenDown, nil
+}
+
+// CloseCampaign ends a live campaign as funded or failed depending on
+// whether it reached its goal.
+func (s *service) CloseCampaign(campaign Campaign) (Campaign, error) {
+	status := StatusFailed
+
+	if campaign.CurrentAmount >= campaign.GoalAmount {
+		status = StatusFunded
+	}
+
+	return s.transition(campaign, status)
+}
+
+// CloseExpiredCampaigns closes every live campaign whose deadline is at or
+// before now and returns how many were closed.
+func (s *service) CloseExpiredCampaigns(now time.Time) (int, error) {
+	campaigns, err := s.repository.FindExpired(now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	var closeErr error
+
+	for _, campaign := range campaigns {
+		_, err := s.CloseCampaign(campaign)
+
+		if err != nil {
+			closeErr = err
+			continue
+		}
+
+		closed++
+	}
+
+	return closed, closeErr
+}
+
+func (s *service) transition(campaign Campaign, to string) (Campaign, error) {
+	if campaign.ID == 0 {
+		return campaign, ErrNotFound
+	}
+
+	if !CanTransition(campaign.Status, to) {
+		return campaign, fmt.Errorf("cannot move campaign from %s to %s", campaign.Status, to)
+	}
+
+	updated, err := s.repository.UpdateStatus(campaign.ID, campaign.Status, to)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	if !updated {
+		return campaign, errors.New("campaign status was changed concurrently")
+	}
+
+	campaign.Status = to
+
+	return campaign, nil
+}
+
+func (s *service) GetCategories() ([]Category, error) {
+	categories, err := s.repository.FindCategories()
+
+	if err != nil {
+		return categories, err
+	}
+
+	return categories, nil
+}
+
+func (s *service) GetCategoryCampaigns(input GetCategoryInput, listing GetCampaignsInput, viewer user.User) (Category, []Campaign, helper.Pagination, error) {
+	category, err := s.repository.FindCategoryBySlug(input.Slug)
+
+	if err != nil {
+		return category, []Campaign{}, helper.Pagination{}, err
+	}
+
+	if category.ID == 0 {
+		return category, []Campaign{}, helper.Pagination{}, errors.New("No category found with that slug")
+	}
+
+	listing.Category = category.Slug
+
+	campaigns, pagination, err := s.GetCampaigns(listing, viewer)
+
+	if err != nil {
+		return category, campaigns, pagination, err
+	}
+
+	return category, campaigns, pagination, nil
+}
+
+func (s *service) CreateCategory(input CategoryInput, currentUser user.User) (Category, error) {
+	err := policy.Authorize(currentUser, policy.CategoryManage)
+
+	if err != nil {
+		return Category{}, err
+	}
+
+	category := Category{}
+	category.Name = input.Name
+	category.Slug = slug.Make(input.Name)
+	category.Description = input.Description
+
+	existing, err := s.repository.FindCategoryBySlug(category.Slug)
+
+	if err != nil {
+		return category, err
+	}
+
+	if existing.ID != 0 {
+		return category, errors.New("category already exists")
+	}
+
+	newCategory, err := s.repository.SaveCategory(category)
+
+	if err != nil {
+		return newCategory, err
+	}
+
+	return newCategory, nil
+}
+
+func (s *service) UpdateCategory(input GetCategoryInput, inputData CategoryInput, currentUser user.User) (Category, error) {
+	err := policy.Authorize(currentUser, policy.CategoryManage)
+
+	if err != nil {
+		return Category{}, err
+	}
+
+	category, err := s.repository.FindCategoryBySlug(input.Slug)
+
+	if err != nil {
+		return category, err
+	}
+
+	if category.ID == 0 {
+		return category, errors.New("No category found with that slug")
+	}
+
+	category.Name = inputData.Name
+	category.Description = inputData.Description
+
+	updateCategory, err := s.repository.UpdateCategory(category)
+
+	if err != nil {
+		return updateCategory, err
+	}
+
+	return updateCategory, nil
+}
+
+func (s *service) DeleteCategory(input GetCategoryInput, currentUser user.User) error {
+	err := policy.Authorize(currentUser, policy.CategoryManage)
+
+	if err != nil {
+		return err
+	}
+
+	category, err := s.repository.FindCategoryBySlug(input.Slug)
+
+	if err != nil {
+		return err
+	}
+
+	if category.ID == 0 {
+		return errors.New("No category found with that slug")
+	}
+
+	return s.repository.DeleteCategory(category.ID)
+}
+
+func (s *service) checkCategory(categoryID int) error {
+	if categoryID == 0 {
+		return nil
+	}
+
+	category, err := s.repository.FindCategoryByID(categoryID)
+
+	if err != nil {
+		return err
+	}
+
+	if category.ID == 0 {
+		return errors.New("No category found with that ID")
+	}
+
+	return nil
+}
+
+func (s *service) CreateRewardTier(input GetCampaignDetailInput, inputData RewardTierInput, currentUser user.User) (RewardTier, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return RewardTier{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return RewardTier{}, err
+	}
+
+	if IsClosed(campaign.Status) {
+		return RewardTier{}, errors.New("campaign is already closed")
+	}
+
+	rewardTier, err := newRewardTier(inputData, campaign)
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	newTier, err := s.repository.SaveRewardTier(rewardTier)
+
+	if err != nil {
+		return newTier, err
+	}
+
+	return newTier, nil
+}
+
+func (s *service) UpdateRewardTier(input GetRewardTierInput, inputData RewardTierInput, currentUser user.User) (RewardTier, error) {
+	campaign, rewardTier, err := s.findOwnedRewardTier(input, currentUser)
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	if inputData.QuantityLimit > 0 && inputData.QuantityLimit < rewardTier.ClaimedCount {
+		return rewardTier, fmt.Errorf("quantity limit cannot be lower than the %d already claimed", rewardTier.ClaimedCount)
+	}
+
+	if rewardTier.ClaimedCount > 0 && inputData.MinimumAmount > rewardTier.MinimumAmount {
+		return rewardTier, errors.New("cannot raise the minimum pledge of a claimed reward")
+	}
+
+	updated, err := newRewardTier(inputData, campaign)
+
+	if err != nil {
+		return rewardTier, err
+	}
+
+	rewardTier.Title = updated.Title
+	rewardTier.Description = updated.Description
+	rewardTier.MinimumAmount = updated.MinimumAmount
+	rewardTier.QuantityLimit = updated.QuantityLimit
+	rewardTier.EstimatedDelivery = updated.EstimatedDelivery
+	rewardTier.RequiresShipping = updated.RequiresShipping
+
+	updateTier, err := s.repository.UpdateRewardTier(rewardTier)
+
+	if err != nil {
+		return updateTier, err
+	}
+
+	return updateTier, nil
+}
+
+func (s *service) DeleteRewardTier(input GetRewardTierInput, currentUser user.User) error {
+	_, rewardTier, err := s.findOwnedRewardTier(input, currentUser)
+
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repository.DeleteRewardTier(rewardTier.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return errors.New("cannot delete a reward that backers have already claimed")
+	}
+
+	return nil
+}
+
+func (s *service) findOwnedRewardTier(input GetRewardTierInput, currentUser user.User) (Campaign, RewardTier, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, RewardTier{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return campaign, RewardTier{}, err
+	}
+
+	if IsClosed(campaign.Status) {
+		return campaign, RewardTier{}, errors.New("campaign is already closed")
+	}
+
+	rewardTier, err := s.repository.FindRewardTierByID(input.RewardTierID)
+
+	if err != nil {
+		return campaign, rewardTier, err
+	}
+
+	if rewardTier.ID == 0 || rewardTier.CampaignID != campaign.ID {
+		return campaign, rewardTier, errors.New("No reward found with that ID")
+	}
+
+	return campaign, rewardTier, nil
+}
+
+func newRewardTier(input RewardTierInput, campaign Campaign) (RewardTier, error) {
+	if input.EstimatedDelivery.Before(campaign.EndsAt) {
+		return RewardTier{}, fmt.Errorf("estimated delivery of %q must be after the campaign ends", input.Title)
+	}
+
+	rewardTier := RewardTier{}
+	rewardTier.CampaignID = campaign.ID
+	rewardTier.Title = input.Title
+	rewardTier.Description = input.Description
+	rewardTier.MinimumAmount = input.MinimumAmount
+	rewardTier.QuantityLimit = input.QuantityLimit
+	rewardTier.EstimatedDelivery = input.EstimatedDelivery
+	rewardTier.RequiresShipping = input.RequiresShipping
+
+	return rewardTier, nil
+}
+
+func (s *service) GetCampaignImages(input GetCampaignDetailInput, viewer user.User) ([]CampaignImages, error) {
+	campaign, err := s.findVisible(input.ID, viewer)
+
+	if err != nil {
+		return []CampaignImages{}, err
+	}
+
+	return campaign.CampaignImages, nil
+}
+
+func (s *service) GetCampaignImage(input GetCampaignImageInput, viewer user.User) (CampaignImages, error) {
+	campaign, err := s.findVisible(input.ID, viewer)
+
+	if err != nil {
+		return CampaignImages{}, err
+	}
+
+	return findImage(campaign, input.ImageID)
+}
+
+func (s *service) SetPrimaryImage(input GetCampaignImageInput, currentUser user.User) (CampaignImages, error) {
+	campaign, campaignImage, err := s.findOwnedImage(input, currentUser)
+
+	if err != nil {
+		return campaignImage, err
+	}
+
+	found, err := s.repository.SetPrimaryImage(campaign.ID, campaignImage.ID)
+
+	if err != nil {
+		return campaignImage, err
+	}
+
+	if !found {
+		return campaignImage, errors.New("No image found with that ID")
+	}
+
+	campaignImage.IsPrimary = 1
+
+	return campaignImage, nil
+}
+
+// ReorderImages expects the IDs of all of the campaign's images, in their new
+// order.
+func (s *service) ReorderImages(input GetCampaignDetailInput, inputData ReorderImagesInput, currentUser user.User) ([]CampaignImages, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return []CampaignImages{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return []CampaignImages{}, err
+	}
+
+	imagesByID := map[int]CampaignImages{}
+
+	for _, campaignImage := range campaign.CampaignImages {
+		imagesByID[campaignImage.ID] = campaignImage
+	}
+
+	if len(inputData.ImageIDs) != len(imagesByID) {
+		return []CampaignImages{}, fmt.Errorf("image_ids must list each of the campaign's %d images once", len(imagesByID))
+	}
+
+	ordered := []CampaignImages{}
+
+	for i, imageID := range inputData.ImageIDs {
+		campaignImage, ok := imagesByID[imageID]
+
+		if !ok {
+			return []CampaignImages{}, fmt.Errorf("image_ids must list each of the campaign's %d images once", len(imagesByID))
+		}
+
+		delete(imagesByID, imageID)
+
+		campaignImage.Position = i + 1
+		ordered = append(ordered, campaignImage)
+	}
+
+	err = s.repository.ReorderImages(campaign.ID, inputData.ImageIDs)
+
+	if err != nil {
+		return []CampaignImages{}, err
+	}
+
+	return ordered, nil
+}
+
+// DeleteCampaignImage returns the deleted image, so the caller can remove its
+// files.
+func (s *service) DeleteCampaignImage(input GetCampaignImageInput, currentUser user.User) (CampaignImages, error) {
+	_, campaignImage, err := s.findOwnedImage(input, currentUser)
+
+	if err != nil {
+		return campaignImage, err
+	}
+
+	err = s.repository.DeleteImage(campaignImage)
+
+	if err != nil {
+		return campaignImage, err
+	}
+
+	return campaignImage, nil
+}
+
+func (s *service) findOwnedImage(input GetCampaignImageInput, currentUser user.User) (Campaign, CampaignImages, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return campaign, CampaignImages{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return campaign, CampaignImages{}, err
+	}
+
+	campaignImage, err := findImage(campaign, input.ImageID)
+
+	return campaign, campaignImage, err
+}
+
+func findImage(campaign Campaign, imageID int) (CampaignImages, error) {
+	for _, campaignImage := range campaign.CampaignImages {
+		if campaignImage.ID == imageID {
+			return campaignImage, nil
+		}
+	}
+
+	return CampaignImages{}, errors.New("No image found with that ID")
+}
+
+// GetCampaignUpdates lists the published updates. The owner also sees drafts
+// and scheduled updates.
+func (s *service) GetCampaignUpdates(input GetCampaignDetailInput, viewer user.User) ([]CampaignUpdate, error) {
+	campaign, err := s.findVisible(input.ID, viewer)
+
+	if err != nil {
+		return []CampaignUpdate{}, err
+	}
+
+	includeDrafts := policy.CanOnOwned(viewer, policy.CampaignUpdate, campaign.UserID)
+	campaignUpdates, err := s.repository.FindCampaignUpdates(campaign.ID, includeDrafts, time.Now())
+
+	if err != nil {
+		return []CampaignUpdate{}, err
+	}
+
+	return s.hideBackersOnly(campaign, campaignUpdates, viewer)
+}
+
+func (s *service) GetCampaignUpdate(input GetCampaignUpdateInput, viewer user.User) (CampaignUpdate, error) {
+	campaign, err := s.findVisible(input.ID, viewer)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	campaignUpdate, err := s.repository.FindCampaignUpdateByID(input.UpdateID)
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	if campaignUpdate.ID == 0 || campaignUpdate.CampaignID != campaign.ID ||
+		(!campaignUpdate.IsPublished(time.Now()) && !policy.CanOnOwned(viewer, policy.CampaignUpdate, campaign.UserID)) {
+		return CampaignUpdate{}, errors.New("No update found with that ID")
+	}
+
+	campaignUpdates, err := s.hideBackersOnly(campaign, []CampaignUpdate{campaignUpdate}, viewer)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	return campaignUpdates[0], nil
+}
+
+func (s *service) CreateCampaignUpdate(input GetCampaignDetailInput, inputData CampaignUpdateInput, currentUser user.User) (CampaignUpdate, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	err = checkCampaignUpdateInput(inputData)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	campaignUpdate := CampaignUpdate{}
+	campaignUpdate.CampaignID = campaign.ID
+	applyCampaignUpdateInput(&campaignUpdate, inputData, time.Now())
+
+	newUpdate, err := s.repository.SaveCampaignUpdate(campaignUpdate)
+
+	if err != nil {
+		return newUpdate, err
+	}
+
+	return newUpdate, nil
+}
+
+func (s *service) UpdateCampaignUpdate(input GetCampaignUpdateInput, inputData CampaignUpdateInput, currentUser user.User) (CampaignUpdate, error) {
+	campaignUpdate, err := s.findOwnedCampaignUpdate(input, currentUser)
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	err = checkCampaignUpdateInput(inputData)
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	applyCampaignUpdateInput(&campaignUpdate, inputData, time.Now())
+
+	updated, err := s.repository.UpdateCampaignUpdate(campaignUpdate)
+
+	if err != nil {
+		return updated, err
+	}
+
+	return updated, nil
+}
+
+func (s *service) DeleteCampaignUpdate(input GetCampaignUpdateInput, currentUser user.User) error {
+	campaignUpdate, err := s.findOwnedCampaignUpdate(input, currentUser)
+
+	if err != nil {
+		return err
+	}
+
+	return s.repository.DeleteCampaignUpdate(campaignUpdate.ID)
+}
+
+// NotifyBackers emails the backers of each campaign about its updates that
+// have been published since the last run, and returns how many updates were
+// sent out. Every send is recorded per backer; an update is only marked
+// notified once each backer got it or failed MaxUpdateAttempts times, so a
+// failed send is retried on the next run and nobody gets the update twice.
+func (s *service) NotifyBackers(now time.Time, limit int) (int, error) {
+	campaignUpdates, err := s.repository.FindUnnotifiedCampaignUpdates(now, limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	notified, failed := 0, 0
+	var sendErr error
+
+	for _, campaignUpdate := range campaignUpdates {
+		campaign, err := s.repository.FindByID(campaignUpdate.CampaignID)
+
+		if err != nil {
+			return notified, err
+		}
+
+		recipients, err := s.repository.FindUpdateRecipients(campaignUpdate, MaxUpdateAttempts)
+
+		if err != nil {
+			return notified, err
+		}
+
+		complete := true
+
+		for _, backer := range recipients {
+			message := mailer.Message{}
+			message.To = backer.Email
+			message.Subject = fmt.Sprintf("%s: %s", campaign.Name, campaignUpdate.Title)
+			message.Body = fmt.Sprintf("Hi %s,\n\n%s, a campaign you backed, has posted an update.\n\n%s\n\n%s\n", backer.Name, campaign.Name, campaignUpdate.Title, campaignUpdate.Body)
+
+			delivery := CampaignUpdateDelivery{}
+			delivery.CampaignUpdateID = campaignUpdate.ID
+			delivery.UserID = backer.ID
+
+			err := s.mailer.Send(message)
+
+			if err != nil {
+				failed++
+				sendErr = err
+				complete = false
+				delivery.LastError = err.Error()
+			} else {
+				sentAt := now
+				delivery.SentAt = &sentAt
+			}
+
+			err = s.repository.RecordUpdateDelivery(delivery)
+
+			if err != nil {
+				return notified, err
+			}
+		}
+
+		if !complete {
+			continue
+		}
+
+		marked, err := s.repository.MarkCampaignUpdateNotified(campaignUpdate.ID, now)
+
+		if err != nil {
+			return notified, err
+		}
+
+		if marked {
+			notified++
+		}
+	}
+
+	if failed > 0 {
+		return notified, fmt.Errorf("failed to send %d update emails: %s", failed, sendErr.Error())
+	}
+
+	return notified, nil
+}
+
+func (s *service) findOwnedCampaignUpdate(input GetCampaignUpdateInput, currentUser user.User) (CampaignUpdate, error) {
+	campaign, err := s.findCampaign(input.ID)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.CampaignUpdate, campaign.UserID)
+
+	if err != nil {
+		return CampaignUpdate{}, err
+	}
+
+	campaignUpdate, err := s.repository.FindCampaignUpdateByID(input.UpdateID)
+
+	if err != nil {
+		return campaignUpdate, err
+	}
+
+	if campaignUpdate.ID == 0 || campaignUpdate.CampaignID != campaign.ID {
+		return CampaignUpdate{}, errors.New("No update found with that ID")
+	}
+
+	return campaignUpdate, nil
+}
+
+// hideBackersOnly blanks the body of backers-only updates unless the viewer
+// backed the campaign or may see it regardless, such as its owner.
+func (s *service) hideBackersOnly(campaign Campaign, campaignUpdates []CampaignUpdate, viewer user.User) ([]CampaignUpdate, error) {
+	backersOnly := false
+
+	for _, campaignUpdate := range campaignUpdates {
+		backersOnly = backersOnly || campaignUpdate.BackersOnly
+	}
+
+	if !backersOnly || policy.CanOnOwned(viewer, policy.CampaignView, campaign.UserID) {
+		return campaignUpdates, nil
+	}
+
+	if viewer.ID != 0 {
+		backer, err := s.repository.IsBacker(campaign.ID, viewer.ID)
+
+		if err != nil || backer {
+			return campaignUpdates, err
+		}
+	}
+
+	for i := range campaignUpdates {
+		if campaignUpdates[i].BackersOnly {
+			campaignUpdates[i].Body = ""
+		}
+	}
+
+	return campaignUpdates, nil
+}
+
+// applyCampaignUpdateInput copies the input onto the update. Once an update
+// is out it stays published at its original time; until then it can be
+// rescheduled or turned back into a draft.
+func applyCampaignUpdateInput(campaignUpdate *CampaignUpdate, input CampaignUpdateInput, now time.Time) {
+	campaignUpdate.Title = input.Title
+	campaignUpdate.Body = input.Body
+	campaignUpdate.BackersOnly = input.BackersOnly
+
+	if campaignUpdate.IsPublished(now) {
+		return
+	}
+
+	campaignUpdate.PublishedAt = input.PublishedAt
+
+	if input.PublishedAt != nil && input.PublishedAt.Before(now) {
+		campaignUpdate.PublishedAt = &now
+	}
+}
+
+// checkCampaignUpdateInput rejects line breaks in the title, which becomes
+// the subject of the emails sent to backers.
+func checkCampaignUpdateInput(input CampaignUpdateInput) error {
+	if strings.ContainsAny(input.Title, "\r\n") {
+		return errors.New("update title must not contain line breaks")
+	}
+
+	return nil
+}
+
+// uniqueSlug derives the slug for a campaign name and suffixes it until no
+// other campaign uses it or used it before.
+func (s *service) uniqueSlug(name string, userID int, campaignID int) (string, error) {
+	base := slug.Make(fmt.Sprintf("%s %d", name, userID))
+	candidate := base
+
+	for i := 2; i <= 100; i++ {
+		taken, err := s.repository.IsSlugTaken(candidate, campaignID)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !taken {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	return "", errors.New("could not find a free slug for the campaign")
+}
+
+func validateSchedule(startsAt time.Time, endsAt time.Time, now time.Time) error {
+	if !endsAt.After(startsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	if !endsAt.After(now) {
+		return errors.New("ends_at must be in the future")
+	}
+
+	if endsAt.Sub(startsAt) > MaxCampaignDuration {
+		return fmt.Errorf("campaign cannot run longer than %d days", int(MaxCampaignDuration.Hours()/24))
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package campaign
+
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusLive      = "live"
+	StatusFunded    = "funded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusTakenDown = "taken_down"
+)
+
+const (
+	FundingAllOrNothing = "all_or_nothing"
+	FundingKeepItAll    = "keep_it_all"
+)
+
+var statusTransitions = map[string][]string{
+	StatusDraft:    {StatusInReview, StatusCancelled, StatusTakenDown},
+	StatusInReview: {StatusLive, StatusDraft, StatusCancelled, StatusTakenDown},
+	StatusLive:     {StatusFunded, StatusFailed, StatusCancelled, StatusTakenDown},
+	StatusFunded:   {StatusTakenDown},
+	StatusFailed:   {StatusTakenDown},
+}
+
+// ClosedStatuses no longer accept pledges or edits.
+var ClosedStatuses = []string{StatusFunded, StatusFailed, StatusCancelled, StatusTakenDown}
+
+// ListedStatuses are shown in public listings; PublicStatuses can also be
+// opened directly by anyone, everything else only by its owner or an admin.
+var (
+	ListedStatuses = []string{StatusLive}
+	PublicStatuses = []string{StatusLive, StatusFunded, StatusFailed}
+)
+
+func CanTransition(from string, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsPublic(status string) bool {
+	for _, public := range PublicStatuses {
+		if public == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsClosed(status string) bool {
+	for _, closed := range ClosedStatuses {
+		if closed == status {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,493 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go_crowdfund/oidc"
+	"go_crowdfund/ratelimit"
+	"go_crowdfund/storage"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	DatabaseDSN           string
+	ListenAddr            string
+	BaseURL               string
+	JWTSecret             string
+	JWTAlgorithm          string
+	JWTKeyRotation        time.Duration
+	AccessTokenTTL        time.Duration
+	RefreshTokenTTL       time.Duration
+	StorageDriver         string
+	UploadDir             string
+	StorageURLSecret      string
+	S3                    storage.S3Config
+	MaxAvatarSize         int64
+	MaxCampaignImageSize  int64
+	CORSOrigins           []string
+	TrustedProxies        []string
+	PaymentSandbox        bool
+	PaymentSandboxSecret  string
+	MidtransServerKey     string
+	MidtransProduction    bool
+	SearchBackend         string
+	SchedulerInterval     time.Duration
+	Mailer                string
+	SMTPHost              string
+	SMTPPort              int
+	SMTPUsername          string
+	SMTPPassword          string
+	MailFrom              string
+	EmailTokenSecret      string
+	EmailVerificationTTL  time.Duration
+	EmailVerificationURL  string
+	PasswordResetTTL      time.Duration
+	PasswordResetURL      string
+	TOTPIssuer            string
+	TOTPEncryptionKey     string
+	TwoFactorChallengeTTL time.Duration
+	OIDCProviders         []oidc.Provider
+	OIDCRedirectURL       string
+	OIDCSandbox           bool
+	RateLimitPerIP        ratelimit.Rate
+	RateLimitPerAccount   ratelimit.Rate
+	LockoutThreshold      int
+	LockoutBase           time.Duration
+	LockoutMax            time.Duration
+}
+
+// ValidationError lists every invalid setting found while loading, so they
+// can all be fixed in one go.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value string
+}
+
+func defaults() []*setting {
+	return []*setting{
+		{"DB_DSN", "db-dsn", "MySQL data source name", ""},
+		{"LISTEN_ADDR", "listen", "address the HTTP server listens on", ":8080"},
+		{"APP_BASE_URL", "base-url", "public URL of this server", "http://localhost:8080"},
+		{"JWT_SECRET_KEY", "jwt-secret", "secret that encrypts the stored token signing keys", ""},
+		{"JWT_ALGORITHM", "jwt-algorithm", "access token signing algorithm: EdDSA or RS256", "EdDSA"},
+		{"JWT_KEY_ROTATION", "jwt-key-rotation", "how often a new token signing key is generated", "720h"},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "how long access tokens stay valid", "15m"},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "how long refresh tokens stay valid", "720h"},
+		{"STORAGE_DRIVER", "storage-driver", "where uploaded files are kept: local or s3", "local"},
+		{"UPLOAD_DIR", "upload-dir", "directory the local storage driver keeps uploaded files in", "./images"},
+		{"STORAGE_URL_SECRET", "storage-url-secret", "secret the local storage driver signs private file URLs with", ""},
+		{"S3_ENDPOINT", "s3-endpoint", "S3-compatible endpoint, such as https://s3.eu-west-1.amazonaws.com or a MinIO URL", ""},
+		{"S3_REGION", "s3-region", "S3 region", "us-east-1"},
+		{"S3_BUCKET", "s3-bucket", "S3 bucket uploaded files are kept in", ""},
+		{"S3_ACCESS_KEY_ID", "s3-access-key-id", "S3 access key ID", ""},
+		{"S3_SECRET_ACCESS_KEY", "s3-secret-access-key", "S3 secret access key", ""},
+		{"S3_PUBLIC_URL", "s3-public-url", "URL the bucket is publicly readable at, such as a CDN; defaults to the bucket URL", ""},
+		{"MAX_AVATAR_SIZE", "max-avatar-size", "maximum avatar upload size in bytes", "2097152"},
+		{"MAX_CAMPAIGN_IMAGE_SIZE", "max-campaign-image-size", "maximum campaign image upload size in bytes", "5242880"},
+		{"CORS_ORIGINS", "cors-origins", "comma-separated origins allowed to call the API", ""},
+		{"TRUSTED_PROXIES", "trusted-proxies", "comma-separated proxy IPs or CIDRs whose X-Forwarded-For is believed", ""},
+		{"PAYMENT_SANDBOX", "payment-sandbox", "take payments with a local sandbox at /sandbox/payments that settles them on request; never enable in production", "false"},
+		{"PAYMENT_SANDBOX_SECRET", "payment-sandbox-secret", "secret the sandbox payment gateway signs callbacks with", ""},
+		{"MIDTRANS_SERVER_KEY", "midtrans-server-key", "Midtrans server key, used when the payment sandbox is off", ""},
+		{"MIDTRANS_PRODUCTION", "midtrans-production", "use Midtrans' live environment instead of its sandbox", "false"},
+		{"SEARCH_BACKEND", "search-backend", "campaign search backend: mysql or memory", "mysql"},
+		{"SCHEDULER_INTERVAL", "scheduler-interval", "how often background jobs run", "1m"},
+		{"RATE_LIMIT_PER_IP", "rate-limit-per-ip", "requests one IP may make to each sign-in endpoint, as count/window", "30/1m"},
+		{"RATE_LIMIT_PER_ACCOUNT", "rate-limit-per-account", "requests each sign-in endpoint accepts for one email, as count/window", "10/1m"},
+		{"LOGIN_LOCKOUT_THRESHOLD", "login-lockout-threshold", "failed logins before an account is locked", "5"},
+		{"LOGIN_LOCKOUT_BASE", "login-lockout-base", "first lockout duration; it doubles with every further failure", "1m"},
+		{"LOGIN_LOCKOUT_MAX", "login-lockout-max", "longest lockout duration", "1h"},
+		{"MAILER", "mailer", "how email is sent: smtp, or memory to keep it in process", "memory"},
+		{"SMTP_HOST", "smtp-host", "SMTP relay host", ""},
+		{"SMTP_PORT", "smtp-port", "SMTP relay port", "587"},
+		{"SMTP_USERNAME", "smtp-username", "SMTP username, empty to send without auth", ""},
+		{"SMTP_PASSWORD", "smtp-password", "SMTP password", ""},
+		{"MAIL_FROM", "mail-from", "sender address of outgoing email", "no-reply@localhost"},
+		{"EMAIL_TOKEN_SECRET", "email-token-secret", "secret used to sign email verification links", ""},
+		{"EMAIL_VERIFICATION_TTL", "email-verification-ttl", "how long email verification links stay valid", "48h"},
+		{"PASSWORD_RESET_TTL", "password-reset-ttl", "how long password reset links stay valid", "1h"},
+		{"PASSWORD_RESET_URL", "password-reset-url", "page the password reset link points to; it posts the token to /users/password/reset", "http://localhost:3000/reset-password"},
+		{"EMAIL_VERIFICATION_URL", "email-verification-url", "page the verification link points to; it posts the token to /users/verify", "http://localhost:3000/verify-email"},
+		{"TOTP_ISSUER", "totp-issuer", "name authenticator apps show for two-factor codes", "Crowdfund"},
+		{"TOTP_ENCRYPTION_KEY", "totp-encryption-key", "secret that encrypts the stored two-factor secrets", ""},
+		{"TWO_FACTOR_CHALLENGE_TTL", "two-factor-challenge-ttl", "how long a login has to enter its two-factor code", "5m"},
+		{"OIDC_PROVIDERS", "oidc-providers", "JSON list of OpenID Connect providers: [{\"name\", \"issuer\", \"client_id\", \"client_secret\", \"scopes\"}]", "[]"},
+		{"OIDC_REDIRECT_URL", "oidc-redirect-url", "page providers redirect to after sign-in; it posts the code and state to the callback endpoint", "http://localhost:3000/oauth/callback"},
+		{"OIDC_SANDBOX", "oidc-sandbox", "serve a local OpenID Connect provider at /sandbox/oidc that signs in any email; never enable in production", "false"},
+	}
+}
+
+// Load reads the configuration from, in increasing order of precedence, the
+// built-in defaults, an optional env-style file, environment variables and
+// command-line flags. The file is given with -config or CONFIG_FILE and
+// defaults to .env, which may be missing.
+func Load(args []string) (Config, error) {
+	settings := defaults()
+
+	flags := flag.NewFlagSet("crowdfund", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "env-style file to read settings from")
+
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.env] = flags.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+
+	err := flags.Parse(args)
+
+	if err != nil {
+		return Config{}, err
+	}
+
+	fileValues, err := readFile(*configFile)
+
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, s := range settings {
+		if value, ok := fileValues[s.env]; ok {
+			s.value = value
+		}
+
+		if value, ok := os.LookupEnv(s.env); ok {
+			s.value = value
+		}
+
+		if *flagValues[s.env] != "" {
+			s.value = *flagValues[s.env]
+		}
+	}
+
+	return parse(settings)
+}
+
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		values, err := godotenv.Read(".env")
+
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+
+		return values, err
+	}
+
+	return godotenv.Read(path)
+}
+
+func parse(settings []*setting) (Config, error) {
+	values := map[string]string{}
+	for _, s := range settings {
+		values[s.env] = strings.TrimSpace(s.value)
+	}
+
+	var problems ValidationError
+	config := Config{}
+
+	config.DatabaseDSN = values["DB_DSN"]
+	if config.DatabaseDSN == "" {
+		problems = append(problems, "DB_DSN is required")
+	}
+
+	config.ListenAddr = values["LISTEN_ADDR"]
+	if config.ListenAddr == "" {
+		problems = append(problems, "LISTEN_ADDR is required")
+	}
+
+	config.BaseURL = strings.TrimRight(values["APP_BASE_URL"], "/")
+	if !isAbsoluteURL(config.BaseURL) {
+		problems = append(problems, "APP_BASE_URL must be an absolute http(s) URL")
+	}
+
+	config.JWTSecret = values["JWT_SECRET_KEY"]
+	if len(config.JWTSecret) < 32 {
+		problems = append(problems, "JWT_SECRET_KEY must be at least 32 characters")
+	}
+
+	config.JWTAlgorithm = values["JWT_ALGORITHM"]
+	if config.JWTAlgorithm != "EdDSA" && config.JWTAlgorithm != "RS256" {
+		problems = append(problems, "JWT_ALGORITHM must be EdDSA or RS256")
+	}
+
+	config.JWTKeyRotation, problems = parseDuration(values, "JWT_KEY_ROTATION", time.Hour, problems)
+	config.AccessTokenTTL, problems = parseDuration(values, "ACCESS_TOKEN_TTL", time.Minute, problems)
+	config.RefreshTokenTTL, problems = parseDuration(values, "REFRESH_TOKEN_TTL", time.Hour, problems)
+	if config.AccessTokenTTL > 0 && config.RefreshTokenTTL > 0 && config.RefreshTokenTTL <= config.AccessTokenTTL {
+		problems = append(problems, "REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	config.StorageDriver = values["STORAGE_DRIVER"]
+	switch config.StorageDriver {
+	case "local":
+		config.UploadDir = values["UPLOAD_DIR"]
+		if config.UploadDir == "" {
+			problems = append(problems, "UPLOAD_DIR is required when STORAGE_DRIVER is local")
+		}
+
+		config.StorageURLSecret = values["STORAGE_URL_SECRET"]
+		if len(config.StorageURLSecret) < 32 {
+			problems = append(problems, "STORAGE_URL_SECRET must be at least 32 characters when STORAGE_DRIVER is local")
+		}
+	case "s3":
+		config.S3.Endpoint = strings.TrimRight(values["S3_ENDPOINT"], "/")
+		if !isAbsoluteURL(config.S3.Endpoint) {
+			problems = append(problems, "S3_ENDPOINT must be an absolute http(s) URL when STORAGE_DRIVER is s3")
+		}
+
+		config.S3.Region = values["S3_REGION"]
+		config.S3.Bucket = values["S3_BUCKET"]
+		config.S3.AccessKeyID = values["S3_ACCESS_KEY_ID"]
+		config.S3.SecretAccessKey = values["S3_SECRET_ACCESS_KEY"]
+		if config.S3.Region == "" || config.S3.Bucket == "" || config.S3.AccessKeyID == "" || config.S3.SecretAccessKey == "" {
+			problems = append(problems, "S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when STORAGE_DRIVER is s3")
+		}
+
+		config.S3.PublicURL = values["S3_PUBLIC_URL"]
+		if config.S3.PublicURL != "" && !isAbsoluteURL(config.S3.PublicURL) {
+			problems = append(problems, "S3_PUBLIC_URL must be an absolute http(s) URL")
+		}
+	default:
+		problems = append(problems, "STORAGE_DRIVER must be local or s3")
+	}
+
+	config.MaxAvatarSize, problems = parseSize(values, "MAX_AVATAR_SIZE", problems)
+	config.MaxCampaignImageSize, problems = parseSize(values, "MAX_CAMPAIGN_IMAGE_SIZE", problems)
+
+	for _, origin := range strings.Split(values["CORS_ORIGINS"], ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+
+		if origin == "" {
+			continue
+		}
+
+		if origin != "*" && !isAbsoluteURL(origin) {
+			problems = append(problems, fmt.Sprintf("CORS_ORIGINS entry %q must be * or an absolute http(s) URL", origin))
+			continue
+		}
+
+		config.CORSOrigins = append(config.CORSOrigins, origin)
+	}
+
+	for _, proxy := range strings.Split(values["TRUSTED_PROXIES"], ",") {
+		proxy = strings.TrimSpace(proxy)
+
+		if proxy == "" {
+			continue
+		}
+
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		if cidrErr != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES entry %q must be an IP address or CIDR", proxy))
+			continue
+		}
+
+		config.TrustedProxies = append(config.TrustedProxies, proxy)
+	}
+
+	var err error
+
+	config.PaymentSandbox, err = strconv.ParseBool(values["PAYMENT_SANDBOX"])
+	if err != nil {
+		problems = append(problems, "PAYMENT_SANDBOX must be true or false")
+	}
+
+	config.MidtransProduction, err = strconv.ParseBool(values["MIDTRANS_PRODUCTION"])
+	if err != nil {
+		problems = append(problems, "MIDTRANS_PRODUCTION must be true or false")
+	}
+
+	if config.PaymentSandbox {
+		config.PaymentSandboxSecret = values["PAYMENT_SANDBOX_SECRET"]
+		if len(config.PaymentSandboxSecret) < 16 {
+			problems = append(problems, "PAYMENT_SANDBOX_SECRET must be at least 16 characters when PAYMENT_SANDBOX is true")
+		}
+	} else {
+		config.MidtransServerKey = values["MIDTRANS_SERVER_KEY"]
+		if config.MidtransServerKey == "" {
+			problems = append(problems, "MIDTRANS_SERVER_KEY is required when PAYMENT_SANDBOX is false")
+		}
+	}
+
+	config.SearchBackend = values["SEARCH_BACKEND"]
+	if config.SearchBackend != "mysql" && config.SearchBackend != "memory" {
+		problems = append(problems, "SEARCH_BACKEND must be mysql or memory")
+	}
+
+	config.SchedulerInterval, problems = parseDuration(values, "SCHEDULER_INTERVAL", time.Second, problems)
+
+	config.RateLimitPerIP, problems = parseRate(values, "RATE_LIMIT_PER_IP", problems)
+	config.RateLimitPerAccount, problems = parseRate(values, "RATE_LIMIT_PER_ACCOUNT", problems)
+
+	threshold, err := strconv.Atoi(values["LOGIN_LOCKOUT_THRESHOLD"])
+	if err != nil || threshold <= 0 {
+		problems = append(problems, "LOGIN_LOCKOUT_THRESHOLD must be a positive number")
+	}
+	config.LockoutThreshold = threshold
+
+	config.LockoutBase, problems = parseDuration(values, "LOGIN_LOCKOUT_BASE", time.Second, problems)
+	config.LockoutMax, problems = parseDuration(values, "LOGIN_LOCKOUT_MAX", time.Second, problems)
+	if config.LockoutBase > 0 && config.LockoutMax > 0 && config.LockoutMax < config.LockoutBase {
+		problems = append(problems, "LOGIN_LOCKOUT_MAX must not be shorter than LOGIN_LOCKOUT_BASE")
+	}
+
+	config.Mailer = values["MAILER"]
+	if config.Mailer != "smtp" && config.Mailer != "memory" {
+		problems = append(problems, "MAILER must be smtp or memory")
+	}
+
+	config.SMTPHost = values["SMTP_HOST"]
+	if config.Mailer == "smtp" && config.SMTPHost == "" {
+		problems = append(problems, "SMTP_HOST is required when MAILER is smtp")
+	}
+
+	port, err := strconv.Atoi(values["SMTP_PORT"])
+	if err != nil || port <= 0 || port > 65535 {
+		problems = append(problems, "SMTP_PORT must be a port number")
+	}
+	config.SMTPPort = port
+
+	config.SMTPUsername = values["SMTP_USERNAME"]
+	config.SMTPPassword = values["SMTP_PASSWORD"]
+
+	config.MailFrom = values["MAIL_FROM"]
+	if !strings.Contains(config.MailFrom, "@") {
+		problems = append(problems, "MAIL_FROM must be an email address")
+	}
+
+	config.EmailTokenSecret = values["EMAIL_TOKEN_SECRET"]
+	if len(config.EmailTokenSecret) < 32 {
+		problems = append(problems, "EMAIL_TOKEN_SECRET must be at least 32 characters")
+	}
+
+	config.EmailVerificationTTL, problems = parseDuration(values, "EMAIL_VERIFICATION_TTL", time.Hour, problems)
+
+	config.EmailVerificationURL = values["EMAIL_VERIFICATION_URL"]
+	if !isAbsoluteURL(config.EmailVerificationURL) {
+		problems = append(problems, "EMAIL_VERIFICATION_URL must be an absolute http(s) URL")
+	}
+
+	config.PasswordResetTTL, problems = parseDuration(values, "PASSWORD_RESET_TTL", 5*time.Minute, problems)
+
+	config.PasswordResetURL = values["PASSWORD_RESET_URL"]
+	if !isAbsoluteURL(config.PasswordResetURL) {
+		problems = append(problems, "PASSWORD_RESET_URL must be an absolute http(s) URL")
+	}
+
+	config.TOTPIssuer = values["TOTP_ISSUER"]
+	if config.TOTPIssuer == "" || strings.Contains(config.TOTPIssuer, ":") {
+		problems = append(problems, "TOTP_ISSUER is required and must not contain a colon")
+	}
+
+	config.TOTPEncryptionKey = values["TOTP_ENCRYPTION_KEY"]
+	if len(config.TOTPEncryptionKey) < 32 {
+		problems = append(problems, "TOTP_ENCRYPTION_KEY must be at least 32 characters")
+	}
+
+	config.TwoFactorChallengeTTL, problems = parseDuration(values, "TWO_FACTOR_CHALLENGE_TTL", time.Minute, problems)
+
+	config.OIDCSandbox, err = strconv.ParseBool(values["OIDC_SANDBOX"])
+	if err != nil {
+		problems = append(problems, "OIDC_SANDBOX must be true or false")
+	}
+
+	config.OIDCProviders, problems = parseProviders(values["OIDC_PROVIDERS"], config.OIDCSandbox, problems)
+
+	config.OIDCRedirectURL = values["OIDC_REDIRECT_URL"]
+	if !isAbsoluteURL(config.OIDCRedirectURL) {
+		problems = append(problems, "OIDC_REDIRECT_URL must be an absolute http(s) URL")
+	}
+
+	if len(problems) > 0 {
+		return config, problems
+	}
+
+	return config, nil
+}
+
+func parseSize(values map[string]string, key string, problems ValidationError) (int64, ValidationError) {
+	size, err := strconv.ParseInt(values[key], 10, 64)
+
+	if err != nil || size <= 0 {
+		return 0, append(problems, key+" must be a positive number of bytes")
+	}
+
+	return size, problems
+}
+
+func isAbsoluteURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func parseDuration(values map[string]string, key string, min time.Duration, problems ValidationError) (time.Duration, ValidationError) {
+	duration, err := time.ParseDuration(values[key])
+
+	if err != nil || duration < min {
+		return duration, append(problems, fmt.Sprintf("%s must be a duration of at least %s", key, min))
+	}
+
+	return duration, problems
+}
+
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+func parseProviders(raw string, sandbox bool, problems ValidationError) ([]oidc.Provider, ValidationError) {
+	var providers []oidc.Provider
+
+	err := json.Unmarshal([]byte(raw), &providers)
+
+	if err != nil {
+		return nil, append(problems, "OIDC_PROVIDERS must be a JSON list of providers: "+err.Error())
+	}
+
+	seen := map[string]bool{}
+
+	for _, provider := range providers {
+		if !providerName.MatchString(provider.Name) {
+			problems = append(problems, fmt.Sprintf("OIDC_PROVIDERS name %q must be lowercase letters, digits and dashes", provider.Name))
+		}
+
+		if seen[provider.Name] || (sandbox && provider.Name == oidc.SandboxProvider) {
+			problems = append(problems, fmt.Sprintf("OIDC_PROVIDERS name %q is used twice", provider.Name))
+		}
+		seen[provider.Name] = true
+
+		if !isAbsoluteURL(provider.Issuer) {
+			problems = append(problems, fmt.Sprintf("OIDC_PROVIDERS issuer of %q must be an absolute http(s) URL", provider.Name))
+		}
+
+		if provider.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("OIDC_PROVIDERS client_id of %q is required", provider.Name))
+		}
+	}
+
+	return providers, problems
+}
+
+func parseRate(values map[string]string, key string, problems ValidationError) (ratelimit.Rate, ValidationError) {
+	rate, err := ratelimit.ParseRate(values[key])
+
+	if err != nil {
+		return rate, append(problems, key+": "+err.Error())
+	}
+
+	return rate, problems
+}
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"go_crowdfund/audit"
+	"go_crowdfund/auth"
+	"go_crowdfund/campaign"
+	"go_crowdfund/helper"
+	"go_crowdfund/storage"
+	"go_crowdfund/transaction"
+	"go_crowdfund/user"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type adminHandler struct {
+	userService        user.Service
+	authService        auth.Service
+	campaignService    campaign.Service
+	transactionService transaction.Service
+	auditService       audit.Service
+	files              storage.Backend
+}
+
+func NewAdminHandler(userService user.Service, authService auth.Service, campaignService campaign.Service, transactionService transaction.Service, auditService audit.Service, files storage.Backend) *adminHandler {
+	return &adminHandler{userService, authService, campaignService, transactionService, auditService, files}
+}
+
+func (h *adminHandler) GetUsers(c *gin.Context) {
+	var input user.SearchUsersInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get users", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	users, pagination, err := h.userService.SearchUsers(input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Error get users", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponseWithPagination(http.StatusOK, "List of users", "success", user.FormatAdminUsers(users), pagination)
+	c.JSON(http.StatusOK, response)
+}
+
+// SuspendUser also revokes the user's refresh tokens; their access tokens
+// stop working at once because authentication rejects suspended users.
+func (h *adminHandler) SuspendUser(c *gin.Context) {
+	var inputID user.GetUserInput
+	var input audit.RequiredReasonInput
+
+	if !bindAdminInput(c, &inputID, &input, true, "Failed to suspend user") {
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	suspendedUser, err := h.userService.SuspendUser(inputID.ID, input.Reason, currentUser)
+
+	if err == nil {
+		err = h.authService.RevokeAllSessions(suspendedUser.ID)
+	}
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to suspend user", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	h.record(currentUser, audit.ActionUserSuspend, audit.TargetUser, suspendedUser.ID, input.Reason, "")
+
+	response := helper.APIResponse(http.StatusOK, "User suspended", "success", user.FormatAdminUser(suspendedUser))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) ReinstateUser(c *gin.Context) {
+	var inputID user.GetUserInput
+	var input audit.ReasonInput
+
+	if !bindAdminInput(c, &inputID, &input, false, "Failed to reinstate user") {
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	reinstatedUser, err := h.userService.ReinstateUser(inputID.ID)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to reinstate user", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	h.record(currentUser, audit.ActionUserReinstate, audit.TargetUser, reinstatedUser.ID, input.Reason, "")
+
+	response := helper.APIResponse(http.StatusOK, "User reinstated", "success", user.FormatAdminUser(reinstatedUser))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) GrantRole(c *gin.Context) {
+	var inputID user.GetUserInput
+	var input user.GrantRoleInput
+
+	if !bindAdminInput(c, &inputID, &input, true, "Failed to grant role") {
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	updatedUser, err := h.userService.GrantRole(inputID.ID, input.Role)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to grant role", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	h.record(currentUser, audit.ActionRoleGrant, audit.TargetUser, updatedUser.ID, input.Reason, input.Role)
+
+	response := helper.APIResponse(http.StatusOK, "Role granted", "success", user.FormatRoles(updatedUser))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) RevokeRole(c *gin.Context) {
+	var inputID user.RevokeRoleInput
+	var input audit.ReasonInput
+
+	if !bindAdminInput(c, &inputID, &input, false, "Failed to revoke role") {
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	updatedUser, err := h.userService.RevokeRole(inputID, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to revoke role", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	h.record(currentUser, audit.ActionRoleRevoke, audit.TargetUser, updatedUser.ID, input.Reason, inputID.Role)
+
+	response := helper.APIResponse(http.StatusOK, "Role revoked", "success", user.FormatRoles(updatedUser))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) ApproveCampaign(c *gin.Context) {
+	h.changeCampaign(c, audit.ActionCampaignApprove, false, h.campaignService.ApproveCampaign, "Campaign approved", "Failed to approve campaign")
+}
+
+func (h *adminHandler) RejectCampaign(c *gin.Context) {
+	h.changeCampaign(c, audit.ActionCampaignReject, true, h.campaignService.RejectCampaign, "Campaign rejected", "Failed to reject campaign")
+}
+
+func (h *adminHandler) FeatureCampaign(c *gin.Context) {
+	feature := func(input campaign.GetCampaignDetailInput, currentUser user.User) (campaign.Campaign, error) {
+		return h.campaignService.FeatureCampaign(input, true, currentUser)
+	}
+
+	h.changeCampaign(c, audit.ActionCampaignFeature, false, feature, "Campaign featured", "Failed to feature campaign")
+}
+
+func (h *adminHandler) UnfeatureCampaign(c *gin.Context) {
+	unfeature := func(input campaign.GetCampaignDetailInput, currentUser user.User) (campaign.Campaign, error) {
+		return h.campaignService.FeatureCampaign(input, false, currentUser)
+	}
+
+	h.changeCampaign(c, audit.ActionCampaignUnfeature, false, unfeature, "Campaign unfeatured", "Failed to unfeature campaign")
+}
+
+func (h *adminHandler) TakeDownCampaign(c *gin.Context) {
+	h.changeCampaign(c, audit.ActionCampaignTakeDown, true, h.campaignService.TakeDownCampaign, "Campaign taken down", "Failed to take down campaign")
+}
+
+func (h *adminHandler) GetCampaignTransactions(c *gin.Context) {
+	var input transaction.GetCampaignTransactionsInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err == nil {
+		err = c.ShouldBindQuery(&input)
+	}
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get transactions", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	transactions, pagination, err := h.transactionService.GetCampaignTransactions(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Error get transactions", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	h.record(currentUser, audit.ActionTransactionsView, audit.TargetCampaign, input.ID, "", "")
+
+	formatter := transaction.FormatCampaignTransactions(transactions)
+	response := helper.APIResponseWithPagination(http.StatusOK, "List of campaign transactions", "success", formatter, pagination)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) GetAuditLog(c *gin.Context) {
+	var input audit.GetEntriesInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get audit log", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	entries, pagination, err := h.auditService.GetEntries(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Error get audit log", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	response := helper.APIResponseWithPagination(http.StatusOK, "Audit log", "success", audit.FormatEntries(entries), pagination)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *adminHandler) changeCampaign(c *gin.Context, action string, requireReason bool, change func(campaign.GetCampaignDetailInput, user.User) (campaign.Campaign, error), successMessage string, failureMessage string) {
+	var inputID campaign.GetCampaignDetailInput
+	var input audit.ReasonInput
+
+	if !bindAdminInput(c, &inputID, &input, requireReason, failureMessage) {
+		return
+	}
+
+	if requireReason && input.Reason == "" {
+		errorMessage := gin.H{"errors": []string{"a reason is required"}}
+		response := helper.APIResponse(http.StatusUnprocessableEntity, failureMessage, "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	updatedCampaign, err := change(inputID, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), failureMessage, "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	h.record(currentUser, action, audit.TargetCampaign, updatedCampaign.ID, input.Reason, "")
+
+	response := helper.APIResponse(http.StatusOK, successMessage, "success", campaign.FormatCampaign(updatedCampaign, h.files))
+	c.JSON(http.StatusOK, response)
+}
+
+// record writes the audit entry for an action that already succeeded. A
+// failure is logged rather than reported, since the action cannot be undone.
+func (h *adminHandler) record(actor user.User, action string, targetType string, targetID int, reason string, detail string) {
+	err := h.auditService.Record(actor, action, targetType, targetID, reason, detail)
+
+	if err != nil {
+		log.Printf("failed to record audit entry %s on %s %d by user %d: %s", action, targetType, targetID, actor.ID, err.Error())
+	}
+}
+
+// bindAdminInput binds the target from the URI and the body, which may be
+// omitted unless bodyRequired. It writes the error response itself and
+// reports whether the handler may continue.
+func bindAdminInput(c *gin.Context, uriInput interface{}, bodyInput interface{}, bodyRequired bool, failureMessage string) bool {
+	err := c.ShouldBindUri(uriInput)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, failureMessage, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return false
+	}
+
+	if !bodyRequired && c.Request.ContentLength == 0 {
+		return true
+	}
+
+	err = c.ShouldBindJSON(bodyInput)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, failureMessage, "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return false
+	}
+
+	return true
+}
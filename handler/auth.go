@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"go_crowdfund/auth"
+	"go_crowdfund/helper"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type authHandler struct {
+	authService auth.Service
+}
+
+func NewAuthHandler(authService auth.Service) *authHandler {
+	return &authHandler{authService}
+}
+
+// GetJWKS publishes the public half of every non-retired signing key so other
+// services can verify access tokens. It is served bare, as verifiers expect.
+func (h *authHandler) GetJWKS(c *gin.Context) {
+	keys, err := h.authService.PublicKeys()
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusInternalServerError, "Failed to get signing keys", "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	formatter, err := auth.FormatJWKS(keys)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusInternalServerError, "Failed to get signing keys", "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, formatter)
+}
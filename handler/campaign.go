@@ -1,37 +1,81 @@
 package handler
 
 import (
-	"fmt"
 	"go_crowdfund/campaign"
 	"go_crowdfund/helper"
+	"go_crowdfund/storage"
+	"go_crowdfund/upload"
 	"go_crowdfund/user"
 	"net/http"
-	"strconv"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
 )
 
 type campaignHandler struct {
-	service campaign.Service
+	service   campaign.Service
+	files     storage.Backend
+	uploads   *upload.Pipeline
+	imageKind upload.Kind
 }
 
-func NewCampaignHandler(service campaign.Service) *campaignHandler {
-	return &campaignHandler{service}
+func NewCampaignHandler(service campaign.Service, files storage.Backend, uploads *upload.Pipeline, imageKind upload.Kind) *campaignHandler {
+	return &campaignHandler{service, files, uploads, imageKind}
 }
 
 func (h *campaignHandler) GetCampaigns(c *gin.Context) {
-	userID, _ := strconv.Atoi(c.Query("user_id"))
+	var input campaign.GetCampaignsInput
 
-	campaigns, err := h.service.GetCampaigns(userID)
+	err := c.ShouldBindQuery(&input)
 
 	if err != nil {
-		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get campaigns", "error", campaign.FormatCampaigns(campaigns))
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get campaigns", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	campaigns, pagination, err := h.service.GetCampaigns(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Error get campaigns", "error", errorMessage)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	formatCampaign := campaign.FormatCampaigns(campaigns)
-	response := helper.APIResponse(http.StatusOK, "List of campaigns", "success", formatCampaign)
+	formatCampaign := campaign.FormatCampaigns(campaigns, h.files)
+	response := helper.APIResponseWithPagination(http.StatusOK, "List of campaigns", "success", formatCampaign, pagination)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) SearchCampaigns(c *gin.Context) {
+	var input campaign.SearchCampaignsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error search campaigns", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	results, pagination, err := h.service.SearchCampaigns(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Error search campaigns", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatSearchResults(results, h.files)
+	response := helper.APIResponseWithPagination(http.StatusOK, "Search results", "success", formatter, pagination)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -45,7 +89,22 @@ func (h *campaignHandler) GetCampaign(c *gin.Context) {
 		return
 	}
 
-	campaignDetail, err := h.service.GetCampaign(input)
+	campaignDetail, err := h.service.GetCampaign(input, currentUserOrGuest(c))
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get detail of campaign", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignDetail(campaignDetail, h.files)
+	response := helper.APIResponse(http.StatusOK, "Campaign detail", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) GetCampaignBySlug(c *gin.Context) {
+	var input campaign.GetCampaignBySlugInput
+	err := c.ShouldBindUri(&input)
 
 	if err != nil {
 		response := helper.APIResponse(http.StatusBadRequest, "Failed to get detail of campaign", "error", nil)
@@ -53,7 +112,20 @@ func (h *campaignHandler) GetCampaign(c *gin.Context) {
 		return
 	}
 
-	formatter := campaign.FormatCampaignDetail(campaignDetail)
+	campaignDetail, moved, err := h.service.GetCampaignBySlug(input, currentUserOrGuest(c))
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusNotFound, "Failed to get detail of campaign", "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	if moved {
+		c.Redirect(http.StatusMovedPermanently, "/api/v1/campaigns/slug/"+url.PathEscape(campaignDetail.Slug))
+		return
+	}
+
+	formatter := campaign.FormatCampaignDetail(campaignDetail, h.files)
 	response := helper.APIResponse(http.StatusOK, "Campaign detail", "success", formatter)
 	c.JSON(http.StatusOK, response)
 }
@@ -83,7 +155,7 @@ func (h *campaignHandler) CreateCampaign(c *gin.Context) {
 		return
 	}
 
-	formatter := campaign.FormatCampaign(createCampaign)
+	formatter := campaign.FormatCampaign(createCampaign, h.files)
 
 	response := helper.APIResponse(http.StatusOK, "Success to create campaign", "success", formatter)
 	c.JSON(http.StatusOK, response)
@@ -119,18 +191,21 @@ func (h *campaignHandler) UpdateCampaign(c *gin.Context) {
 	updateCampaign, err := h.service.UpdateCampaign(inputID, inputData)
 
 	if err != nil {
-		response := helper.APIResponse(http.StatusBadRequest, "Failed to update campaign", "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+		response := helper.APIResponse(errorStatus(err), "Failed to update campaign", "error", nil)
+		c.JSON(errorStatus(err), response)
 		return
 	}
 
-	formatter := campaign.FormatCampaign(updateCampaign)
+	formatter := campaign.FormatCampaign(updateCampaign, h.files)
 
 	response := helper.APIResponse(http.StatusOK, "Success to update campaign", "success", formatter)
 	c.JSON(http.StatusOK, response)
 }
 
 func (h *campaignHandler) UploadImage(c *gin.Context) {
+	if !limitUpload(c, h.imageKind, "Failed to upload campaign image") {
+		return
+	}
 
 	var input campaign.CreateCampaignImageInput
 
@@ -148,20 +223,17 @@ func (h *campaignHandler) UploadImage(c *gin.Context) {
 		return
 	}
 
-	file, err := c.FormFile("file")
+	err = h.service.AuthorizeImageUpload(input)
 
 	if err != nil {
 		data := gin.H{"is_uploaded": false}
-		response := helper.APIResponse(http.StatusBadRequest, "Failed to upload campaign image", "error", data)
-		c.JSON(http.StatusBadRequest, response)
+		response := helper.APIResponse(errorStatus(err), "Failed to upload campaign image", "error", data)
+		c.JSON(errorStatus(err), response)
 		return
 	}
 
-	userID := currentUser.ID
-
-	path := fmt.Sprintf("images/campaign/%d-%s", userID, file.Filename)
+	file, err := c.FormFile("file")
 
-	err = c.SaveUploadedFile(file, path)
 	if err != nil {
 		data := gin.H{"is_uploaded": false}
 		response := helper.APIResponse(http.StatusBadRequest, "Failed to upload campaign image", "error", data)
@@ -169,11 +241,19 @@ func (h *campaignHandler) UploadImage(c *gin.Context) {
 		return
 	}
 
-	_, err = h.service.SaveCampaignImage(input, path)
+	stored, err := h.uploads.Save(h.imageKind, file)
+	if err != nil {
+		uploadFailed(c, err, "Failed to upload campaign image")
+		return
+	}
+
+	_, err = h.service.SaveCampaignImage(input, stored.Key, stored.Variants)
 	if err != nil {
+		discardUpload(h.uploads, stored.Key, stored.Variants)
+
 		data := gin.H{"is_uploaded": false}
-		response := helper.APIResponse(http.StatusBadRequest, "Failed to upload campaign image", "error", data)
-		c.JSON(http.StatusBadRequest, response)
+		response := helper.APIResponse(errorStatus(err), "Failed to upload campaign image", "error", data)
+		c.JSON(errorStatus(err), response)
 		return
 	}
 
@@ -181,3 +261,463 @@ func (h *campaignHandler) UploadImage(c *gin.Context) {
 	response := helper.APIResponse(http.StatusOK, "Avatar successfully uploaded", "success", data)
 	c.JSON(http.StatusOK, response)
 }
+
+func (h *campaignHandler) SubmitCampaign(c *gin.Context) {
+	h.changeStatus(c, h.service.SubmitCampaign, "Campaign submitted for review", "Failed to submit campaign")
+}
+
+func (h *campaignHandler) ApproveCampaign(c *gin.Context) {
+	h.changeStatus(c, h.service.ApproveCampaign, "Campaign approved", "Failed to approve campaign")
+}
+
+func (h *campaignHandler) RejectCampaign(c *gin.Context) {
+	h.changeStatus(c, h.service.RejectCampaign, "Campaign sent back to draft", "Failed to reject campaign")
+}
+
+func (h *campaignHandler) CancelCampaign(c *gin.Context) {
+	h.changeStatus(c, h.service.CancelCampaign, "Campaign cancelled", "Failed to cancel campaign")
+}
+
+func (h *campaignHandler) changeStatus(c *gin.Context, change func(campaign.GetCampaignDetailInput, user.User) (campaign.Campaign, error), successMessage string, failureMessage string) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, failureMessage, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	updatedCampaign, err := change(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), failureMessage, "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCampaign(updatedCampaign, h.files)
+	response := helper.APIResponse(http.StatusOK, successMessage, "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func currentUserOrGuest(c *gin.Context) user.User {
+	currentUser, ok := c.Get("currentUser")
+
+	if !ok {
+		return user.User{}
+	}
+
+	return currentUser.(user.User)
+}
+
+func (h *campaignHandler) CreateRewardTier(c *gin.Context) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to create reward", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.RewardTierInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to create reward", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	rewardTier, err := h.service.CreateRewardTier(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to create reward", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatRewardTier(rewardTier)
+	response := helper.APIResponse(http.StatusOK, "Success to create reward", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) UpdateRewardTier(c *gin.Context) {
+	var input campaign.GetRewardTierInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to update reward", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.RewardTierInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to update reward", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	rewardTier, err := h.service.UpdateRewardTier(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to update reward", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatRewardTier(rewardTier)
+	response := helper.APIResponse(http.StatusOK, "Success to update reward", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) DeleteRewardTier(c *gin.Context) {
+	var input campaign.GetRewardTierInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to delete reward", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	err = h.service.DeleteRewardTier(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to delete reward", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Success to delete reward", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) GetCampaignImages(c *gin.Context) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign images", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	images, err := h.service.GetCampaignImages(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign images", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignImages(images, h.files)
+	response := helper.APIResponse(http.StatusOK, "List of campaign images", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) GetCampaignImage(c *gin.Context) {
+	var input campaign.GetCampaignImageInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign image", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	image, err := h.service.GetCampaignImage(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign image", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignImage(image, h.files)
+	response := helper.APIResponse(http.StatusOK, "Campaign image", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) SetPrimaryImage(c *gin.Context) {
+	var input campaign.GetCampaignImageInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to set primary image", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	image, err := h.service.SetPrimaryImage(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to set primary image", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignImage(image, h.files)
+	response := helper.APIResponse(http.StatusOK, "Primary image updated", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) ReorderImages(c *gin.Context) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to reorder images", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.ReorderImagesInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to reorder images", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	images, err := h.service.ReorderImages(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to reorder images", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignImages(images, h.files)
+	response := helper.APIResponse(http.StatusOK, "Images reordered", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) DeleteCampaignImage(c *gin.Context) {
+	var input campaign.GetCampaignImageInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to delete campaign image", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	image, err := h.service.DeleteCampaignImage(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to delete campaign image", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	discardUpload(h.uploads, storage.Key(image.FileName), image.VariantNames())
+
+	response := helper.APIResponse(http.StatusOK, "Success to delete campaign image", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) GetCampaignUpdates(c *gin.Context) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign updates", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	campaignUpdates, err := h.service.GetCampaignUpdates(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign updates", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignUpdates(campaignUpdates)
+	response := helper.APIResponse(http.StatusOK, "List of campaign updates", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) GetCampaignUpdate(c *gin.Context) {
+	var input campaign.GetCampaignUpdateInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign update", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	campaignUpdate, err := h.service.GetCampaignUpdate(input, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get campaign update", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignUpdate(campaignUpdate)
+	response := helper.APIResponse(http.StatusOK, "Campaign update", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) CreateCampaignUpdate(c *gin.Context) {
+	var input campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to create campaign update", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.CampaignUpdateInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to create campaign update", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	campaignUpdate, err := h.service.CreateCampaignUpdate(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to create campaign update", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignUpdate(campaignUpdate)
+	response := helper.APIResponse(http.StatusOK, "Success to create campaign update", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) UpdateCampaignUpdate(c *gin.Context) {
+	var input campaign.GetCampaignUpdateInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to update campaign update", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.CampaignUpdateInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to update campaign update", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	campaignUpdate, err := h.service.UpdateCampaignUpdate(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to update campaign update", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCampaignUpdate(campaignUpdate)
+	response := helper.APIResponse(http.StatusOK, "Success to update campaign update", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *campaignHandler) DeleteCampaignUpdate(c *gin.Context) {
+	var input campaign.GetCampaignUpdateInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to delete campaign update", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	err = h.service.DeleteCampaignUpdate(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to delete campaign update", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Success to delete campaign update", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
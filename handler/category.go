@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"go_crowdfund/campaign"
+	"go_crowdfund/helper"
+	"go_crowdfund/storage"
+	"go_crowdfund/user"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type categoryHandler struct {
+	service campaign.Service
+	files   storage.Backend
+}
+
+func NewCategoryHandler(service campaign.Service, files storage.Backend) *categoryHandler {
+	return &categoryHandler{service, files}
+}
+
+func (h *categoryHandler) GetCategories(c *gin.Context) {
+	categories, err := h.service.GetCategories()
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Error get categories", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := campaign.FormatCategories(categories)
+	response := helper.APIResponse(http.StatusOK, "List of categories", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *categoryHandler) GetCategoryCampaigns(c *gin.Context) {
+	var input campaign.GetCategoryInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Error get campaigns", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var listing campaign.GetCampaignsInput
+
+	err = c.ShouldBindQuery(&listing)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Error get campaigns", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	category, campaigns, pagination, err := h.service.GetCategoryCampaigns(input, listing, currentUserOrGuest(c))
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Error get campaigns", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	data := gin.H{
+		"category":  campaign.FormatCategory(category),
+		"campaigns": campaign.FormatCampaigns(campaigns, h.files),
+	}
+
+	response := helper.APIResponseWithPagination(http.StatusOK, "List of campaigns", "success", data, pagination)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *categoryHandler) CreateCategory(c *gin.Context) {
+	var input campaign.CategoryInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to create category", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	category, err := h.service.CreateCategory(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to create category", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCategory(category)
+	response := helper.APIResponse(http.StatusOK, "Success to create category", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *categoryHandler) UpdateCategory(c *gin.Context) {
+	var input campaign.GetCategoryInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to update category", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var inputData campaign.CategoryInput
+
+	err = c.ShouldBindJSON(&inputData)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to update category", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	category, err := h.service.UpdateCategory(input, inputData, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to update category", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := campaign.FormatCategory(category)
+	response := helper.APIResponse(http.StatusOK, "Success to update category", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *categoryHandler) DeleteCategory(c *gin.Context) {
+	var input campaign.GetCategoryInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to delete category", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	err = h.service.DeleteCategory(input, currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to delete category", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Success to delete category", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
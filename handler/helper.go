@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"go_crowdfund/campaign"
+	"go_crowdfund/helper"
+	"go_crowdfund/policy"
+	"go_crowdfund/upload"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorStatus maps a service error to the HTTP status it should be reported
+// with.
+func errorStatus(err error) int {
+	if err == policy.ErrForbidden || err == policy.ErrEmailNotVerified {
+		return http.StatusForbidden
+	}
+
+	if err == campaign.ErrNotFound {
+		return http.StatusNotFound
+	}
+
+	return http.StatusBadRequest
+}
+
+// tooManyRequests aborts with 429 and tells the client when to retry.
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	response := helper.APIResponse(http.StatusTooManyRequests, message, "error", nil)
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, response)
+}
+
+// uploadFailed reports a failed upload, with the reason when the file itself
+// was rejected.
+func uploadFailed(c *gin.Context, err error, message string) {
+	if validationErr, ok := err.(upload.ValidationError); ok {
+		data := gin.H{"is_uploaded": false, "error": validationErr.Message}
+		response := helper.APIResponse(http.StatusUnprocessableEntity, message, "error", data)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	log.Printf("%s: %s", message, err.Error())
+
+	data := gin.H{"is_uploaded": false}
+	response := helper.APIResponse(http.StatusBadRequest, message, "error", data)
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// limitUpload caps the request body at what an upload of the kind may take,
+// so an oversized file is cut off before the form is parsed rather than
+// after. It responds and reports false when the body is declared too large.
+func limitUpload(c *gin.Context, kind upload.Kind, message string) bool {
+	if c.Request.ContentLength > kind.MaxRequestSize() {
+		uploadFailed(c, upload.TooLarge(kind), message)
+		return false
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, kind.MaxRequestSize())
+	return true
+}
+
+// discardUpload deletes a stored file, and its variants, that is no longer
+// referenced. Failures only leave orphaned files behind, so they are logged.
+func discardUpload(uploads *upload.Pipeline, key string, variants []string) {
+	err := uploads.Delete(key, variants)
+
+	if err != nil {
+		log.Printf("failed to delete uploaded file %s: %s", key, err.Error())
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"go_crowdfund/auth"
+	"go_crowdfund/helper"
+	"go_crowdfund/oidc"
+	"go_crowdfund/user"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type oidcHandler struct {
+	oidcService oidc.Service
+	userService user.Service
+	authService auth.Service
+}
+
+func NewOIDCHandler(oidcService oidc.Service, userService user.Service, authService auth.Service) *oidcHandler {
+	return &oidcHandler{oidcService, userService, authService}
+}
+
+func (h *oidcHandler) GetProviders(c *gin.Context) {
+	data := gin.H{"providers": h.oidcService.Providers()}
+	response := helper.APIResponse(http.StatusOK, "List of sign-in providers", "success", data)
+	c.JSON(http.StatusOK, response)
+}
+
+// StartLogin returns the provider URL to send the user to. The provider
+// redirects back to the frontend, which posts the code and state to
+// CompleteLogin.
+func (h *oidcHandler) StartLogin(c *gin.Context) {
+	var input oidc.ProviderInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to start sign-in", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	authorization, err := h.oidcService.StartLogin(input.Provider)
+
+	if err != nil {
+		h.providerError(c, err, "Failed to start sign-in")
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Redirect to the provider to sign in", "success", oidc.FormatAuthorization(authorization))
+	c.JSON(http.StatusOK, response)
+}
+
+// CompleteLogin answers like userHandler.Login, including the two-factor
+// challenge for users who turned it on.
+func (h *oidcHandler) CompleteLogin(c *gin.Context) {
+	var uri oidc.ProviderInput
+	var input oidc.CallbackInput
+
+	if !h.bindCallback(c, &uri, &input, "Login Failed!") {
+		return
+	}
+
+	loggedinUser, err := h.oidcService.CompleteLogin(uri.Provider, input)
+
+	if err != nil {
+		h.providerError(c, err, "Login Failed!")
+		return
+	}
+
+	if loggedinUser.HasTwoFactor() {
+		token, expiresAt := h.userService.CreateTwoFactorChallenge(loggedinUser)
+
+		formatter := user.FormatTwoFactorChallenge(token, expiresAt)
+		response := helper.APIResponse(http.StatusOK, "Two-factor code required", "success", formatter)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	session, err := h.authService.CreateSession(loggedinUser.ID)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Login Failed!", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatUser(loggedinUser, session.AccessToken, session.RefreshToken)
+	response := helper.APIResponse(http.StatusOK, "Login successfully", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *oidcHandler) GetIdentities(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	identities, err := h.oidcService.GetIdentities(currentUser)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get linked accounts", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "List of linked accounts", "success", oidc.FormatIdentities(identities))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *oidcHandler) StartLink(c *gin.Context) {
+	var input oidc.ProviderInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to link account", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	authorization, err := h.oidcService.StartLink(input.Provider, currentUser)
+
+	if err != nil {
+		h.providerError(c, err, "Failed to link account")
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Redirect to the provider to link the account", "success", oidc.FormatAuthorization(authorization))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *oidcHandler) LinkIdentity(c *gin.Context) {
+	var uri oidc.ProviderInput
+	var input oidc.CallbackInput
+
+	if !h.bindCallback(c, &uri, &input, "Failed to link account") {
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	identity, err := h.oidcService.LinkIdentity(uri.Provider, input, currentUser)
+
+	if err != nil {
+		h.providerError(c, err, "Failed to link account")
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Account linked", "success", oidc.FormatIdentity(identity))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *oidcHandler) UnlinkIdentity(c *gin.Context) {
+	var input oidc.ProviderInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to unlink account", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	err = h.oidcService.UnlinkIdentity(input.Provider, currentUser)
+
+	if err != nil {
+		h.providerError(c, err, "Failed to unlink account")
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Account unlinked", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *oidcHandler) bindCallback(c *gin.Context, uri *oidc.ProviderInput, input *oidc.CallbackInput, message string) bool {
+	err := c.ShouldBindUri(uri)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, message, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return false
+	}
+
+	err = c.ShouldBindJSON(input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, message, "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return false
+	}
+
+	return true
+}
+
+func (h *oidcHandler) providerError(c *gin.Context, err error, message string) {
+	status := http.StatusBadRequest
+
+	if err == oidc.ErrUnknownProvider {
+		status = http.StatusNotFound
+	}
+
+	errorMessage := gin.H{"error": err.Error()}
+	response := helper.APIResponse(status, message, "error", errorMessage)
+	c.JSON(status, response)
+}
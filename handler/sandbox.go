@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"go_crowdfund/helper"
+	"go_crowdfund/payment"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sandboxHandler struct {
+	gateway payment.Sandbox
+}
+
+func NewSandboxHandler(gateway payment.Sandbox) *sandboxHandler {
+	return &sandboxHandler{gateway}
+}
+
+func (h *sandboxHandler) GetPayment(c *gin.Context) {
+	var input payment.SandboxPaymentInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to get payment", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	paymentTransaction, ok := h.gateway.GetPayment(input.Token)
+
+	if !ok {
+		response := helper.APIResponse(http.StatusNotFound, "Payment not found", "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	data := gin.H{
+		"code":     paymentTransaction.Code,
+		"amount":   paymentTransaction.Amount,
+		"statuses": []string{payment.StatusPaid, payment.StatusPending, payment.StatusExpired, payment.StatusFailed},
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Sandbox payment", "success", data)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *sandboxHandler) SettlePayment(c *gin.Context) {
+	var input payment.SandboxPaymentInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to settle payment", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var settleInput payment.SandboxSettleInput
+
+	err = c.ShouldBindJSON(&settleInput)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to settle payment", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	err = h.gateway.Simulate(input.Token, settleInput.Status)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to settle payment", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Payment settled", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"go_crowdfund/campaign"
+	"go_crowdfund/helper"
+	"go_crowdfund/payment"
+	"go_crowdfund/transaction"
+	"go_crowdfund/user"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type transactionHandler struct {
+	service        transaction.Service
+	paymentGateway payment.Gateway
+}
+
+func NewTransactionHandler(service transaction.Service, paymentGateway payment.Gateway) *transactionHandler {
+	return &transactionHandler{service, paymentGateway}
+}
+
+func (h *transactionHandler) CreateTransaction(c *gin.Context) {
+	var inputID campaign.GetCampaignDetailInput
+
+	err := c.ShouldBindUri(&inputID)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to create transaction", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var input transaction.CreateTransactionInput
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to create transaction", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+	input.User = currentUser
+	input.CampaignID = inputID.ID
+
+	newTransaction, err := h.service.CreateTransaction(input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(errorStatus(err), "Failed to create transaction", "error", errorMessage)
+		c.JSON(errorStatus(err), response)
+		return
+	}
+
+	formatter := transaction.FormatTransaction(newTransaction)
+	response := helper.APIResponse(http.StatusOK, "Success to create transaction", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *transactionHandler) GetNotification(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to process notification", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	notification, err := h.paymentGateway.ParseNotification(c.Request.Header, body)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to process notification", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err = h.service.ProcessPayment(notification)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to process notification", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Notification processed", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
@@ -1,22 +1,31 @@
 package handler
 
 import (
-	"fmt"
 	"go_crowdfund/auth"
 	"go_crowdfund/helper"
+	"go_crowdfund/ratelimit"
+	"go_crowdfund/storage"
+	"go_crowdfund/upload"
 	"go_crowdfund/user"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
 type userHandler struct {
 	userService user.Service
 	authService auth.Service
+	lockout     *ratelimit.Lockout
+	uploads     *upload.Pipeline
+	avatarKind  upload.Kind
 }
 
-func NewUserHandler(userService user.Service, authService auth.Service) *userHandler {
-	return &userHandler{userService, authService}
+func NewUserHandler(userService user.Service, authService auth.Service, lockout *ratelimit.Lockout, uploads *upload.Pipeline, avatarKind upload.Kind) *userHandler {
+	return &userHandler{userService, authService, lockout, uploads, avatarKind}
 }
 
 func (h *userHandler) RegisterUser(c *gin.Context) {
@@ -40,7 +49,13 @@ func (h *userHandler) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.GenerateToken(createUser.ID)
+	err = h.userService.SendVerificationEmail(createUser)
+
+	if err != nil {
+		log.Printf("failed to send verification email to user %d: %s", createUser.ID, err.Error())
+	}
+
+	session, err := h.authService.CreateSession(createUser.ID)
 
 	if err != nil {
 		response := helper.APIResponse(http.StatusUnprocessableEntity, "Register Failed!", "error", nil)
@@ -48,7 +63,7 @@ func (h *userHandler) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	formatter := user.FormatUser(createUser, token)
+	formatter := user.FormatUser(createUser, session.AccessToken, session.RefreshToken)
 	response := helper.APIResponse(http.StatusOK, "Account successfully registered", "success", formatter)
 
 	c.JSON(http.StatusOK, response)
@@ -68,8 +83,28 @@ func (h *userHandler) Login(c *gin.Context) {
 		return
 	}
 
+	account := strings.ToLower(strings.TrimSpace(input.Email))
+	lockedFor, err := h.lockout.LockedFor(account, time.Now())
+
+	if err != nil {
+		log.Printf("failed to check login lockout: %s", err.Error())
+	}
+
+	if lockedFor > 0 {
+		tooManyRequests(c, lockedFor, "Too many failed login attempts, try again later")
+		return
+	}
+
 	loggedinUser, err := h.userService.Login(input)
 
+	if err == user.ErrInvalidCredentials {
+		_, lockErr := h.lockout.Fail(account, time.Now())
+
+		if lockErr != nil {
+			log.Printf("failed to record failed login: %s", lockErr.Error())
+		}
+	}
+
 	if err != nil {
 		errorMessage := gin.H{"error": err.Error()}
 
@@ -78,17 +113,415 @@ func (h *userHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.GenerateToken(loggedinUser.ID)
+	// With two-factor login on, the lockout is only reset once the second
+	// factor is accepted too, so a known password cannot be used to clear
+	// failed code attempts.
+	if loggedinUser.HasTwoFactor() {
+		token, expiresAt := h.userService.CreateTwoFactorChallenge(loggedinUser)
+
+		formatter := user.FormatTwoFactorChallenge(token, expiresAt)
+		response := helper.APIResponse(http.StatusOK, "Two-factor code required", "success", formatter)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	h.startSession(c, loggedinUser, account, "Login Failed!", "Login successfully")
+}
+
+// VerifyTwoFactor completes a login that returned a challenge token.
+// Failed codes count towards the same lockout as failed passwords.
+func (h *userHandler) VerifyTwoFactor(c *gin.Context) {
+	var input user.TwoFactorLoginInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Login Failed!", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	challengedUser, err := h.userService.ParseTwoFactorChallenge(input.ChallengeToken)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusUnauthorized, "Login Failed!", "error", errorMessage)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	account := strings.ToLower(strings.TrimSpace(challengedUser.Email))
+	lockedFor, err := h.lockout.LockedFor(account, time.Now())
+
+	if err != nil {
+		log.Printf("failed to check login lockout: %s", err.Error())
+	}
+
+	if lockedFor > 0 {
+		tooManyRequests(c, lockedFor, "Too many failed login attempts, try again later")
+		return
+	}
+
+	err = h.userService.VerifySecondFactor(challengedUser, input.Code)
+
+	if err == user.ErrInvalidTwoFactor {
+		_, lockErr := h.lockout.Fail(account, time.Now())
+
+		if lockErr != nil {
+			log.Printf("failed to record failed login: %s", lockErr.Error())
+		}
+	}
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Login Failed!", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	h.startSession(c, challengedUser, account, "Login Failed!", "Login successfully")
+}
+
+func (h *userHandler) startSession(c *gin.Context, loggedinUser user.User, account string, failMessage string, message string) {
+	err := h.lockout.Reset(account)
+
+	if err != nil {
+		log.Printf("failed to reset login lockout: %s", err.Error())
+	}
+
+	session, err := h.authService.CreateSession(loggedinUser.ID)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusUnprocessableEntity, failMessage, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatUser(loggedinUser, session.AccessToken, session.RefreshToken)
+	response := helper.APIResponse(http.StatusOK, message, "success", formatter)
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) RefreshSession(c *gin.Context) {
+	var input auth.RefreshSessionInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to refresh session", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	session, err := h.authService.RefreshSession(input.RefreshToken)
+
+	if err == auth.ErrInvalidRefreshToken {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusUnauthorized, "Failed to refresh session", "error", errorMessage)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to refresh session", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Session refreshed", "success", auth.FormatSession(session))
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) Logout(c *gin.Context) {
+	var input auth.LogoutInput
+
+	if c.Request.ContentLength > 0 {
+		err := c.ShouldBindJSON(&input)
+
+		if err != nil {
+			errors := helper.FormatValidationError(err)
+			errorMessage := gin.H{"errors": errors}
+
+			response := helper.APIResponse(http.StatusUnprocessableEntity, "Logout failed", "error", errorMessage)
+			c.JSON(http.StatusUnprocessableEntity, response)
+			return
+		}
+	}
+
+	token := c.MustGet("currentToken").(*jwt.Token)
+
+	err := h.authService.Logout(token, input.RefreshToken)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Logout failed", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Logged out", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) VerifyEmail(c *gin.Context) {
+	var input user.VerifyEmailInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Email verification failed", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	verifiedUser, err := h.userService.VerifyEmail(input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Email verification failed", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	data := gin.H{"email": verifiedUser.Email, "email_verified": true}
+	response := helper.APIResponse(http.StatusOK, "Email successfully verified", "success", data)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) ResendVerificationEmail(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	err := h.userService.SendVerificationEmail(currentUser)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to send verification email", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	response := helper.APIResponse(http.StatusOK, "Verification email sent", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) ForgotPassword(c *gin.Context) {
+	var input user.ForgotPasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Password reset failed", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	err = h.userService.RequestPasswordReset(input)
+
+	if err != nil {
+		log.Printf("failed to send password reset email: %s", err.Error())
+	}
+
+	response := helper.APIResponse(http.StatusOK, "If that email is registered, a password reset link has been sent", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password from an emailed token and signs the user
+// out everywhere.
+func (h *userHandler) ResetPassword(c *gin.Context) {
+	var input user.ResetPasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Password reset failed", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	updatedUser, err := h.userService.ResetPassword(input)
+
+	if err == nil {
+		err = h.authService.RevokeAllSessions(updatedUser.ID)
+	}
 
 	if err != nil {
-		response := helper.APIResponse(http.StatusUnprocessableEntity, "Login Failed!", "error", nil)
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Password reset failed", "error", errorMessage)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	formatter := user.FormatUser(loggedinUser, token)
-	response := helper.APIResponse(http.StatusOK, "Login successfully", "success", formatter)
+	response := helper.APIResponse(http.StatusOK, "Password has been reset", "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword signs the user out everywhere and returns a new session for
+// the client that made the change.
+func (h *userHandler) ChangePassword(c *gin.Context) {
+	var input user.ChangePasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
 
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to change password", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	updatedUser, err := h.userService.ChangePassword(currentUser.ID, input)
+
+	if err == nil {
+		err = h.authService.RevokeAllSessions(updatedUser.ID)
+	}
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to change password", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	session, err := h.authService.CreateSession(updatedUser.ID)
+
+	if err != nil {
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to change password", "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatUser(updatedUser, session.AccessToken, session.RefreshToken)
+	response := helper.APIResponse(http.StatusOK, "Password changed", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) EnrollTwoFactor(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	secret, uri, err := h.userService.EnrollTwoFactor(currentUser.ID)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to enroll in two-factor authentication", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatTwoFactorEnrollment(secret, uri)
+	response := helper.APIResponse(http.StatusOK, "Scan the code with an authenticator app, then confirm it", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmTwoFactor turns two-factor login on and returns the recovery codes,
+// which are not shown again.
+func (h *userHandler) ConfirmTwoFactor(c *gin.Context) {
+	var input user.TwoFactorCodeInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to enable two-factor authentication", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	codes, err := h.userService.ConfirmTwoFactor(currentUser.ID, input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to enable two-factor authentication", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatRecoveryCodes(codes)
+	response := helper.APIResponse(http.StatusOK, "Two-factor authentication enabled", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var input user.TwoFactorCodeInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to regenerate recovery codes", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	codes, err := h.userService.RegenerateRecoveryCodes(currentUser.ID, input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to regenerate recovery codes", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	formatter := user.FormatRecoveryCodes(codes)
+	response := helper.APIResponse(http.StatusOK, "Recovery codes regenerated", "success", formatter)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *userHandler) DisableTwoFactor(c *gin.Context) {
+	var input user.DisableTwoFactorInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		errors := helper.FormatValidationError(err)
+		errorMessage := gin.H{"errors": errors}
+
+		response := helper.APIResponse(http.StatusUnprocessableEntity, "Failed to disable two-factor authentication", "error", errorMessage)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	currentUser := c.MustGet("currentUser").(user.User)
+
+	_, err = h.userService.DisableTwoFactor(currentUser.ID, input)
+
+	if err != nil {
+		errorMessage := gin.H{"error": err.Error()}
+		response := helper.APIResponse(http.StatusBadRequest, "Failed to disable two-factor authentication", "error", errorMessage)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	data := gin.H{"two_factor_enabled": false}
+	response := helper.APIResponse(http.StatusOK, "Two-factor authentication disabled", "success", data)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -133,6 +566,10 @@ func (h *userHandler) CheckEmailAvailability(c *gin.Context) {
 }
 
 func (h *userHandler) UploadAvatar(c *gin.Context) {
+	if !limitUpload(c, h.avatarKind, "Failed to upload avatar") {
+		return
+	}
+
 	file, err := c.FormFile("avatar")
 
 	if err != nil {
@@ -145,24 +582,24 @@ func (h *userHandler) UploadAvatar(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(user.User)
 	userID := currentUser.ID
 
-	path := fmt.Sprintf("images/avatar/%d-%s", userID, file.Filename)
-
-	err = c.SaveUploadedFile(file, path)
+	stored, err := h.uploads.Save(h.avatarKind, file)
 	if err != nil {
-		data := gin.H{"is_uploaded": false}
-		response := helper.APIResponse(http.StatusBadRequest, "Failed to upload avatar", "error", data)
-		c.JSON(http.StatusBadRequest, response)
+		uploadFailed(c, err, "Failed to upload avatar")
 		return
 	}
 
-	_, err = h.userService.SaveAvatar(userID, path)
+	_, err = h.userService.SaveAvatar(userID, stored.Key, stored.Variants)
 	if err != nil {
+		discardUpload(h.uploads, stored.Key, stored.Variants)
+
 		data := gin.H{"is_uploaded": false}
 		response := helper.APIResponse(http.StatusBadRequest, "Failed to upload avatar", "error", data)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
+	discardUpload(h.uploads, storage.Key(currentUser.AvatarFileName), currentUser.AvatarVariantNames())
+
 	data := gin.H{"is_uploaded": true}
 	response := helper.APIResponse(http.StatusOK, "Avatar successfully uploaded", "success", data)
 	c.JSON(http.StatusOK, response)
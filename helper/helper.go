@@ -1,6 +1,12 @@
 package helper
 
-import "github.com/go-playground/validator/v10"
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+)
 
 type Response struct {
 	Meta Meta        `json:"meta"`
@@ -8,9 +14,16 @@ type Response struct {
 }
 
 type Meta struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
+	Message    string      `json:"message"`
+	Code       int         `json:"code"`
+	Status     string      `json:"status"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Pagination struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor"`
 }
 
 func APIResponse(code int, message, status string, data interface{}) Response {
@@ -28,9 +41,59 @@ func APIResponse(code int, message, status string, data interface{}) Response {
 	return resultJson
 }
 
+func APIResponseWithPagination(code int, message, status string, data interface{}, pagination Pagination) Response {
+	response := APIResponse(code, message, status, data)
+	response.Meta.Pagination = &pagination
+
+	return response
+}
+
+// EncodeCursor and DecodeCursor turn list offsets into opaque cursors, so
+// clients page by passing back next_cursor instead of computing offsets.
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+
+	offset, err := strconv.Atoi(string(decoded))
+
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return offset, nil
+}
+
+func NewPagination(total int64, offset int, limit int) Pagination {
+	pagination := Pagination{Total: total, Limit: limit}
+
+	if int64(offset+limit) < total {
+		pagination.NextCursor = EncodeCursor(offset + limit)
+	}
+
+	return pagination
+}
+
 func FormatValidationError(err error) []string {
 	var errors []string
-	for _, e := range err.(validator.ValidationErrors) {
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+
+	if !ok {
+		return append(errors, err.Error())
+	}
+
+	for _, e := range validationErrors {
 		errors = append(errors, e.Error())
 	}
 
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mail through an SMTP relay, authenticating with PLAIN
+// auth when a username is given. net/smtp upgrades to TLS when the server
+// offers STARTTLS.
+func NewSMTPMailer(host string, port int, username string, password string, from string) *smtpMailer {
+	var auth smtp.Auth
+
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpMailer{net.JoinHostPort(host, fmt.Sprint(port)), auth, from}
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return errors.New("mail headers must not contain line breaks")
+	}
+
+	var body strings.Builder
+	body.WriteString("From: " + m.from + "\r\n")
+	body.WriteString("To: " + message.To + "\r\n")
+	body.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	body.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	body.WriteString("\r\n")
+	body.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, []byte(body.String()))
+}
@@ -1,14 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go_crowdfund/audit"
 	"go_crowdfund/auth"
 	"go_crowdfund/campaign"
+	"go_crowdfund/config"
 	"go_crowdfund/handler"
 	"go_crowdfund/helper"
+	"go_crowdfund/mailer"
+	"go_crowdfund/oidc"
+	"go_crowdfund/payment"
+	"go_crowdfund/policy"
+	"go_crowdfund/ratelimit"
+	"go_crowdfund/scheduler"
+	"go_crowdfund/search"
+	"go_crowdfund/storage"
+	"go_crowdfund/transaction"
+	"go_crowdfund/upload"
 	"go_crowdfund/user"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
@@ -17,8 +40,13 @@ import (
 )
 
 func main() {
-	dsn := "root:@tcp(127.0.0.1:3306)/bwastartup?charset=utf8mb4&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	cfg, err := config.Load(os.Args[1:])
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	db, err := gorm.Open(mysql.Open(cfg.DatabaseDSN), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
 
 	if err != nil {
 		log.Fatal(err.Error())
@@ -26,44 +54,401 @@ func main() {
 
 	userRepository := user.NewRepository(db)
 	campaignRepository := campaign.NewRepository(db)
-	userService := user.NewService(userRepository)
-	authService := auth.NewService()
+	transactionRepository := transaction.NewRepository(db)
+	authRepository := auth.NewRepository(db)
+
+	err = campaignRepository.DeduplicateSlugs()
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = db.AutoMigrate(&campaign.Campaign{}, &campaign.RewardTier{}, &campaign.CampaignSlug{}, &campaign.CampaignUpdate{}, &campaign.CampaignUpdateDelivery{}, &campaign.Category{}, &campaign.Tag{}, &transaction.Transaction{}, &transaction.Refund{}, &scheduler.Lease{}, &auth.RefreshToken{}, &auth.RevokedToken{}, &auth.SigningKey{}, &user.User{}, &user.PasswordResetToken{}, &user.RecoveryCode{}, &oidc.Identity{}, &oidc.LoginState{}, &audit.Entry{})
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// Legacy campaigns get their schedule first, since migrated perks take
+	// their estimated delivery from the campaign's end.
+	_, err = campaignRepository.BackfillSchedules(time.Now())
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	_, err = campaignRepository.MigratePerks()
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	emailLinks := user.EmailLinks{
+		TokenSecret:      cfg.EmailTokenSecret,
+		VerificationURL:  cfg.EmailVerificationURL,
+		VerificationTTL:  cfg.EmailVerificationTTL,
+		PasswordResetURL: cfg.PasswordResetURL,
+		PasswordResetTTL: cfg.PasswordResetTTL,
+	}
+	twoFactor := user.TwoFactor{
+		Issuer:        cfg.TOTPIssuer,
+		EncryptionKey: cfg.TOTPEncryptionKey,
+		ChallengeTTL:  cfg.TwoFactorChallengeTTL,
+	}
+	mail := newMailer(cfg)
+	userService := user.NewService(userRepository, mail, emailLinks, twoFactor)
+	authService := auth.NewService(cfg.JWTSecret, cfg.JWTAlgorithm, cfg.JWTKeyRotation, authRepository, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+
+	err = authService.EnsureSigningKey()
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	authHandler := handler.NewAuthHandler(authService)
+
+	rateLimitStore := ratelimit.NewMemoryStore()
+	limiter := ratelimit.NewLimiter(rateLimitStore)
+	lockout := ratelimit.NewLockout(rateLimitStore, cfg.LockoutThreshold, cfg.LockoutBase, cfg.LockoutMax)
+
+	files, filesHandler := newStorage(cfg)
+
+	uploads := upload.NewPipeline(files)
+	avatarKind := upload.Kind{
+		Name:    "avatar",
+		Folder:  "avatar",
+		MaxSize: cfg.MaxAvatarSize,
+		Variants: []upload.Variant{
+			{Name: "thumb", Width: 64, Height: 64, Crop: true},
+			{Name: "card", Width: 256, Height: 256, Crop: true},
+		},
+	}
+	campaignImageKind := upload.Kind{
+		Name:    "campaign image",
+		Folder:  "campaign",
+		MaxSize: cfg.MaxCampaignImageSize,
+		Variants: []upload.Variant{
+			{Name: "thumb", Width: 240, Height: 240, Crop: true},
+			{Name: "card", Width: 640, Height: 360, Crop: true},
+			{Name: "hero", Width: 1600, Height: 900},
+		},
+	}
+
+	userHandler := handler.NewUserHandler(userService, authService, lockout, uploads, avatarKind)
+	searchIndex, err := newSearchIndex(cfg.SearchBackend, db, campaignRepository)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	campaignService := campaign.NewService(campaignRepository, searchIndex, mail)
+	campaignHandle := handler.NewCampaignHandler(campaignService, files, uploads, campaignImageKind)
+	categoryHandler := handler.NewCategoryHandler(campaignService, files)
+
+	paymentGateway, paymentSandbox := newPaymentGateway(cfg)
+	transactionService := transaction.NewService(transactionRepository, campaignRepository, paymentGateway)
+	transactionHandler := handler.NewTransactionHandler(transactionService, paymentGateway)
+
+	oidcProviders := cfg.OIDCProviders
+	var oidcSandbox http.Handler
+
+	if cfg.OIDCSandbox {
+		issuer, err := oidc.NewSandboxIssuer(cfg.BaseURL + "/sandbox/oidc")
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 
-	userHandler := handler.NewUserHandler(userService, authService)
-	campaignService := campaign.NewService(campaignRepository)
-	campaignHandle := handler.NewCampaignHandler(campaignService)
+		oidcProviders = append(oidcProviders, issuer.Provider())
+		oidcSandbox = http.StripPrefix("/sandbox/oidc", issuer)
+	}
+
+	oidcService := oidc.NewService(oidc.NewRepository(db), userRepository, oidcProviders, cfg.OIDCRedirectURL)
+	oidcHandler := handler.NewOIDCHandler(oidcService, userService, authService)
+
+	auditService := audit.NewService(audit.NewRepository(db))
+	adminHandler := handler.NewAdminHandler(userService, authService, campaignService, transactionService, auditService, files)
+
+	jobScheduler := scheduler.NewScheduler(scheduler.NewRepository(db))
+	jobScheduler.Every("close-expired-campaigns", cfg.SchedulerInterval, func(ctx context.Context) error {
+		closed, err := campaignService.CloseExpiredCampaigns(time.Now())
+
+		if closed > 0 {
+			log.Printf("closed %d expired campaigns", closed)
+		}
+
+		return err
+	})
+	jobScheduler.Every("expire-pending-pledges", cfg.SchedulerInterval, func(ctx context.Context) error {
+		expired, err := transactionService.ExpirePendingTransactions(time.Now(), 100)
+
+		if expired > 0 {
+			log.Printf("expired %d unpaid pledges", expired)
+		}
+
+		return err
+	})
+	jobScheduler.Every("process-refunds", cfg.SchedulerInterval, func(ctx context.Context) error {
+		_, err := transactionService.QueueRefunds()
+
+		if err != nil {
+			return err
+		}
+
+		refunded, err := transactionService.ProcessRefunds(100)
+
+		if refunded > 0 {
+			log.Printf("refunded %d pledges", refunded)
+		}
+
+		return err
+	})
+	jobScheduler.Every("notify-campaign-updates", cfg.SchedulerInterval, func(ctx context.Context) error {
+		notified, err := campaignService.NotifyBackers(time.Now(), 20)
+
+		if notified > 0 {
+			log.Printf("sent %d campaign updates to backers", notified)
+		}
+
+		return err
+	})
+	jobScheduler.Every("rotate-signing-keys", cfg.SchedulerInterval, func(ctx context.Context) error {
+		return authService.RotateKeys(time.Now())
+	})
+	jobScheduler.Every("delete-expired-tokens", time.Hour, func(ctx context.Context) error {
+		return authService.DeleteExpired(time.Now())
+	})
+	jobScheduler.Every("delete-expired-login-states", time.Hour, func(ctx context.Context) error {
+		return oidcService.DeleteExpired(time.Now())
+	})
 
 	router := gin.Default()
-	router.Static("/images", "./images")
+
+	err = router.SetTrustedProxies(cfg.TrustedProxies)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	router.Use(corsMiddleware(cfg.CORSOrigins))
+
+	if filesHandler != nil {
+		router.GET("/files/*key", gin.WrapH(filesHandler))
+		router.HEAD("/files/*key", gin.WrapH(filesHandler))
+	}
+
+	router.GET("/.well-known/jwks.json", authHandler.GetJWKS)
+
+	if paymentSandbox != nil {
+		sandboxHandler := handler.NewSandboxHandler(paymentSandbox)
+		router.GET("/sandbox/payments/:token", sandboxHandler.GetPayment)
+		router.POST("/sandbox/payments/:token", sandboxHandler.SettlePayment)
+	}
+
+	if oidcSandbox != nil {
+		router.Any("/sandbox/oidc/*path", gin.WrapH(oidcSandbox))
+	}
+
 	api := router.Group("/api/v1")
 
-	api.POST("/users", userHandler.RegisterUser)
-	api.POST("/sessions", userHandler.Login)
-	api.POST("/email_checkers", userHandler.CheckEmailAvailability)
+	perIP := func(bucket string) gin.HandlerFunc {
+		return rateLimitMiddleware(limiter, bucket, cfg.RateLimitPerIP, ratelimit.Rate{}, nil)
+	}
+	perIPAndAccount := func(bucket string) gin.HandlerFunc {
+		return rateLimitMiddleware(limiter, bucket, cfg.RateLimitPerIP, cfg.RateLimitPerAccount, emailFromBody)
+	}
+
+	api.POST("/users", perIP("register"), userHandler.RegisterUser)
+	api.POST("/sessions", perIPAndAccount("login"), userHandler.Login)
+	api.POST("/sessions/two-factor", perIP("two-factor"), userHandler.VerifyTwoFactor)
+	api.POST("/sessions/refresh", perIP("refresh"), userHandler.RefreshSession)
+	api.DELETE("/sessions", authMiddleware(authService, userService), userHandler.Logout)
+	api.GET("/auth/providers", oidcHandler.GetProviders)
+	api.POST("/auth/oidc/:provider", perIP("oidc"), oidcHandler.StartLogin)
+	api.POST("/auth/oidc/:provider/callback", perIP("oidc"), oidcHandler.CompleteLogin)
+	api.POST("/email_checkers", perIP("email-check"), userHandler.CheckEmailAvailability)
+	api.POST("/users/verify", perIP("verify"), userHandler.VerifyEmail)
+	api.POST("/users/verify/resend", authMiddleware(authService, userService), userHandler.ResendVerificationEmail)
+	api.POST("/users/password/forgot", perIPAndAccount("password-forgot"), userHandler.ForgotPassword)
+	api.POST("/users/password/reset", perIP("password-reset"), userHandler.ResetPassword)
+	api.PUT("/users/me/password", authMiddleware(authService, userService), userHandler.ChangePassword)
+	api.POST("/users/me/two-factor", authMiddleware(authService, userService), userHandler.EnrollTwoFactor)
+	api.POST("/users/me/two-factor/confirm", authMiddleware(authService, userService), perIP("two-factor"), userHandler.ConfirmTwoFactor)
+	api.POST("/users/me/two-factor/recovery-codes", authMiddleware(authService, userService), perIP("two-factor"), userHandler.RegenerateRecoveryCodes)
+	api.DELETE("/users/me/two-factor", authMiddleware(authService, userService), perIP("two-factor"), userHandler.DisableTwoFactor)
+	api.GET("/users/me/identities", authMiddleware(authService, userService), oidcHandler.GetIdentities)
+	api.POST("/users/me/identities/:provider", authMiddleware(authService, userService), oidcHandler.StartLink)
+	api.POST("/users/me/identities/:provider/callback", authMiddleware(authService, userService), oidcHandler.LinkIdentity)
+	api.DELETE("/users/me/identities/:provider", authMiddleware(authService, userService), oidcHandler.UnlinkIdentity)
 	api.POST("/avatars", authMiddleware(authService, userService), userHandler.UploadAvatar)
-	api.POST("/campaign", authMiddleware(authService, userService), campaignHandle.CreateCampaign)
+	api.POST("/campaign", authMiddleware(authService, userService), requirePermission(policy.CampaignCreate), campaignHandle.CreateCampaign)
 	api.PUT("/campaign/:id", authMiddleware(authService, userService), campaignHandle.UpdateCampaign)
 	api.POST("/campaign-image", authMiddleware(authService, userService), campaignHandle.UploadImage)
 
-	api.GET("/campaigns", campaignHandle.GetCampaigns)
-	api.GET("/campaigns/:id", campaignHandle.GetCampaign)
+	api.POST("/campaigns/:id/submit", authMiddleware(authService, userService), campaignHandle.SubmitCampaign)
+	api.POST("/campaigns/:id/approve", authMiddleware(authService, userService), requirePermission(policy.CampaignApprove), campaignHandle.ApproveCampaign)
+	api.POST("/campaigns/:id/reject", authMiddleware(authService, userService), requirePermission(policy.CampaignReject), campaignHandle.RejectCampaign)
+	api.POST("/campaigns/:id/cancel", authMiddleware(authService, userService), campaignHandle.CancelCampaign)
+	api.POST("/campaigns/:id/rewards", authMiddleware(authService, userService), campaignHandle.CreateRewardTier)
+	api.PUT("/campaigns/:id/rewards/:rewardID", authMiddleware(authService, userService), campaignHandle.UpdateRewardTier)
+	api.DELETE("/campaigns/:id/rewards/:rewardID", authMiddleware(authService, userService), campaignHandle.DeleteRewardTier)
+	api.GET("/campaigns/:id/images", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaignImages)
+	api.PUT("/campaigns/:id/images/order", authMiddleware(authService, userService), campaignHandle.ReorderImages)
+	api.GET("/campaigns/:id/images/:imageID", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaignImage)
+	api.PUT("/campaigns/:id/images/:imageID/primary", authMiddleware(authService, userService), campaignHandle.SetPrimaryImage)
+	api.DELETE("/campaigns/:id/images/:imageID", authMiddleware(authService, userService), campaignHandle.DeleteCampaignImage)
+	api.GET("/campaigns/:id/updates", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaignUpdates)
+	api.POST("/campaigns/:id/updates", authMiddleware(authService, userService), campaignHandle.CreateCampaignUpdate)
+	api.GET("/campaigns/:id/updates/:updateID", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaignUpdate)
+	api.PUT("/campaigns/:id/updates/:updateID", authMiddleware(authService, userService), campaignHandle.UpdateCampaignUpdate)
+	api.DELETE("/campaigns/:id/updates/:updateID", authMiddleware(authService, userService), campaignHandle.DeleteCampaignUpdate)
+
+	api.GET("/campaigns", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaigns)
+	api.GET("/categories", categoryHandler.GetCategories)
+	api.GET("/categories/:slug/campaigns", optionalAuthMiddleware(authService, userService), categoryHandler.GetCategoryCampaigns)
+	api.POST("/categories", authMiddleware(authService, userService), requirePermission(policy.CategoryManage), categoryHandler.CreateCategory)
+	api.PUT("/categories/:slug", authMiddleware(authService, userService), requirePermission(policy.CategoryManage), categoryHandler.UpdateCategory)
+	api.DELETE("/categories/:slug", authMiddleware(authService, userService), requirePermission(policy.CategoryManage), categoryHandler.DeleteCategory)
+
+	api.GET("/campaigns/slug/:slug", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaignBySlug)
+	api.GET("/campaigns/search", optionalAuthMiddleware(authService, userService), campaignHandle.SearchCampaigns)
+	api.GET("/campaigns/:id", optionalAuthMiddleware(authService, userService), campaignHandle.GetCampaign)
+	api.POST("/campaigns/:id/transactions", authMiddleware(authService, userService), requirePermission(policy.PledgeCreate), transactionHandler.CreateTransaction)
+	api.POST("/transactions/notification", transactionHandler.GetNotification)
+
+	admin := api.Group("/admin", authMiddleware(authService, userService), requirePermission(policy.AdminAccess))
+	admin.GET("/users", requirePermission(policy.UserList), adminHandler.GetUsers)
+	admin.POST("/users/:id/suspend", requirePermission(policy.UserSuspend), adminHandler.SuspendUser)
+	admin.POST("/users/:id/reinstate", requirePermission(policy.UserSuspend), adminHandler.ReinstateUser)
+	admin.POST("/users/:id/roles", requirePermission(policy.RoleManage), adminHandler.GrantRole)
+	admin.DELETE("/users/:id/roles/:role", requirePermission(policy.RoleManage), adminHandler.RevokeRole)
+	admin.POST("/campaigns/:id/approve", requirePermission(policy.CampaignApprove), adminHandler.ApproveCampaign)
+	admin.POST("/campaigns/:id/reject", requirePermission(policy.CampaignReject), adminHandler.RejectCampaign)
+	admin.POST("/campaigns/:id/feature", requirePermission(policy.CampaignFeature), adminHandler.FeatureCampaign)
+	admin.DELETE("/campaigns/:id/feature", requirePermission(policy.CampaignFeature), adminHandler.UnfeatureCampaign)
+	admin.POST("/campaigns/:id/take-down", requirePermission(policy.CampaignTakeDown), adminHandler.TakeDownCampaign)
+	admin.GET("/campaigns/:id/transactions", adminHandler.GetCampaignTransactions)
+	admin.GET("/audit-log", requirePermission(policy.AuditView), adminHandler.GetAuditLog)
+
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: router}
+
+	jobScheduler.Start()
+
+	go func() {
+		err := server.ListenAndServe()
+
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	err = jobScheduler.Shutdown(ctx)
 
-	router.Run()
+	if err != nil {
+		log.Println(err.Error())
+	}
 }
 
-func authMiddleware(authService auth.Service, userService user.Service) gin.HandlerFunc {
+func newSearchIndex(backend string, db *gorm.DB, campaignRepository campaign.Repository) (campaign.SearchIndex, error) {
+	if backend != "memory" {
+		mysqlIndex := search.NewMySQLIndex(db)
+		return mysqlIndex, mysqlIndex.EnsureIndex()
+	}
+
+	memoryIndex := search.NewMemoryIndex()
+
+	campaigns, _, err := campaignRepository.FindAll(campaign.Filter{})
+
+	if err != nil {
+		return memoryIndex, err
+	}
+
+	for _, c := range campaigns {
+		err := memoryIndex.Index(c)
+
+		if err != nil {
+			return memoryIndex, err
+		}
+	}
+
+	return memoryIndex, nil
+}
+
+// newPaymentGateway returns the sandbox, also as the second value so its
+// routes can be mounted, when PAYMENT_SANDBOX is on, and Midtrans otherwise.
+func newPaymentGateway(cfg config.Config) (payment.Gateway, payment.Sandbox) {
+	if cfg.PaymentSandbox {
+		sandbox := payment.NewSandboxGateway([]byte(cfg.PaymentSandboxSecret), cfg.BaseURL)
+		return sandbox, sandbox
+	}
+
+	return payment.NewMidtransGateway(cfg.MidtransServerKey, cfg.MidtransProduction), nil
+}
+
+func newMailer(cfg config.Config) mailer.Mailer {
+	if cfg.Mailer == "smtp" {
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+
+	return mailer.NewMemoryMailer()
+}
+
+// newStorage returns the configured file storage and, for the local driver,
+// the handler that serves its files under /files.
+func newStorage(cfg config.Config) (storage.Backend, http.Handler) {
+	if cfg.StorageDriver == "s3" {
+		return storage.NewS3Backend(cfg.S3), nil
+	}
+
+	local := storage.NewLocalBackend(cfg.UploadDir, cfg.BaseURL+"/files", []byte(cfg.StorageURLSecret))
+
+	return local, http.StripPrefix("/files", local)
+}
+
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
+		origin := c.GetHeader("Origin")
 
-		if !strings.Contains(authHeader, "Bearer") {
-			response := helper.APIResponse(http.StatusUnauthorized, "Unauthorized", "error", nil)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+		if origin == "" || (!allowed["*"] && !allowed[origin]) {
+			c.Next()
 			return
 		}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", -1)
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Vary", "Origin")
 
-		validateToken, err := authService.ValidateToken(tokenString)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func authMiddleware(authService auth.Service, userService user.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, token, err := authenticate(c, authService, userService)
 
 		if err != nil {
 			response := helper.APIResponse(http.StatusUnauthorized, "Unauthorized", "error", nil)
@@ -71,17 +456,18 @@ func authMiddleware(authService auth.Service, userService user.Service) gin.Hand
 			return
 		}
 
-		claim, ok := validateToken.Claims.(jwt.MapClaims)
+		c.Set("currentUser", user)
+		c.Set("currentToken", token)
+	}
+}
 
-		if !ok || !validateToken.Valid {
-			response := helper.APIResponse(http.StatusUnauthorized, "Unauthorized", "error", nil)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+func optionalAuthMiddleware(authService auth.Service, userService user.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
 			return
 		}
 
-		userID := int(claim["user_id"].(float64))
-
-		user, err := userService.GetUserByID(userID)
+		user, token, err := authenticate(c, authService, userService)
 
 		if err != nil {
 			response := helper.APIResponse(http.StatusUnauthorized, "Unauthorized", "error", nil)
@@ -90,6 +476,120 @@ func authMiddleware(authService auth.Service, userService user.Service) gin.Hand
 		}
 
 		c.Set("currentUser", user)
+		c.Set("currentToken", token)
+	}
+}
+
+// rateLimitMiddleware limits how often one client IP may call a route and,
+// when accountKey finds an account in the request, how often the route may be
+// called for that account. Each bucket name is counted separately. If the
+// store fails the request is let through.
+func rateLimitMiddleware(limiter *ratelimit.Limiter, bucket string, perIP ratelimit.Rate, perAccount ratelimit.Rate, accountKey func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		keys := map[string]ratelimit.Rate{bucket + ":ip:" + c.ClientIP(): perIP}
+
+		if accountKey != nil {
+			if account := accountKey(c); account != "" {
+				keys[bucket+":account:"+account] = perAccount
+			}
+		}
+
+		for key, rate := range keys {
+			allowed, retryAfter, err := limiter.Allow(key, rate, now)
+
+			if err != nil {
+				log.Printf("rate limiter failed: %s", err.Error())
+				continue
+			}
+
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				response := helper.APIResponse(http.StatusTooManyRequests, "Too many requests, try again later", "error", nil)
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, response)
+				return
+			}
+		}
+	}
+}
+
+// emailFromBody reads the email from a JSON request body and puts the body
+// back for the handler.
+func emailFromBody(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	json.Unmarshal(body, &payload)
+
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// requirePermission must run after authMiddleware.
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser := c.MustGet("currentUser").(user.User)
+
+		err := policy.Authorize(currentUser, permission)
+
+		if err != nil {
+			errorMessage := gin.H{"error": err.Error()}
+			response := helper.APIResponse(http.StatusForbidden, "Forbidden", "error", errorMessage)
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+	}
+}
+
+func authenticate(c *gin.Context, authService auth.Service, userService user.Service) (user.User, *jwt.Token, error) {
+	authHeader := c.GetHeader("Authorization")
+
+	if !strings.Contains(authHeader, "Bearer") {
+		return user.User{}, nil, errors.New("missing bearer token")
+	}
+
+	tokenString := strings.Replace(authHeader, "Bearer ", "", -1)
+
+	validateToken, err := authService.ValidateToken(tokenString)
+
+	if err != nil {
+		return user.User{}, nil, err
+	}
+
+	claim, ok := validateToken.Claims.(jwt.MapClaims)
+
+	if !ok || !validateToken.Valid {
+		return user.User{}, nil, errors.New("invalid token")
+	}
+
+	userID, ok := claim["user_id"].(float64)
+
+	if !ok {
+		return user.User{}, nil, errors.New("invalid token")
+	}
+
+	currentUser, err := userService.GetUserByID(int(userID))
+
+	if err != nil {
+		return currentUser, nil, err
+	}
+
+	if currentUser.IsSuspended() {
+		return user.User{}, nil, errors.New("account suspended")
+	}
+
+	issuedAt, _ := claim["iat"].(float64)
+
+	if currentUser.PasswordChangedAt != nil && int64(issuedAt) < currentUser.PasswordChangedAt.Unix() {
+		return user.User{}, nil, errors.New("token issued before the password was changed")
 	}
 
+	return currentUser, validateToken, nil
 }
@@ -0,0 +1,30 @@
+package oidc
+
+import "time"
+
+// Identity links an account at an external provider to a user. Subject is
+// the provider's stable ID for the account; Email is informational only.
+type Identity struct {
+	ID         int
+	UserID     int    `gorm:"index"`
+	Provider   string `gorm:"size:50;uniqueIndex:idx_identities_provider_subject"`
+	Subject    string `gorm:"size:255;uniqueIndex:idx_identities_provider_subject"`
+	Email      string
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// LoginState is kept between redirecting the user to the provider and the
+// callback. It holds the PKCE verifier so it never passes through the
+// browser, and is deleted when used. UserID is set when an identity is being
+// linked to a signed-in user.
+type LoginState struct {
+	ID           int
+	StateHash    string `gorm:"size:64;uniqueIndex"`
+	Provider     string `gorm:"size:50"`
+	CodeVerifier string
+	Nonce        string
+	UserID       int
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
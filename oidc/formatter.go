@@ -0,0 +1,45 @@
+package oidc
+
+import "time"
+
+type AuthorizationFormatter struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+func FormatAuthorization(authorization Authorization) AuthorizationFormatter {
+	formatter := AuthorizationFormatter{
+		AuthorizationURL: authorization.URL,
+		State:            authorization.State,
+	}
+
+	return formatter
+}
+
+type IdentityFormatter struct {
+	Provider   string     `json:"provider"`
+	Email      string     `json:"email"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func FormatIdentity(identity Identity) IdentityFormatter {
+	formatter := IdentityFormatter{
+		Provider:   identity.Provider,
+		Email:      identity.Email,
+		LastUsedAt: identity.LastUsedAt,
+		CreatedAt:  identity.CreatedAt,
+	}
+
+	return formatter
+}
+
+func FormatIdentities(identities []Identity) []IdentityFormatter {
+	identitiesFormatter := []IdentityFormatter{}
+
+	for _, identity := range identities {
+		identitiesFormatter = append(identitiesFormatter, FormatIdentity(identity))
+	}
+
+	return identitiesFormatter
+}
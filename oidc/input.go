@@ -0,0 +1,12 @@
+package oidc
+
+type ProviderInput struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+// CallbackInput carries the query parameters the provider redirected to the
+// frontend with.
+type CallbackInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
@@ -0,0 +1,395 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Provider is an OpenID Connect provider users can sign in with. Name is used
+// in URLs and stored with linked identities, so it must not change.
+type Provider struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// Claims are the parts of a verified ID token this app uses.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// keyRefreshInterval limits how often an unknown key ID makes the client
+// fetch the provider's keys again.
+const keyRefreshInterval = 30 * time.Second
+
+// client talks to one provider. The discovery document and signing keys are
+// fetched on first use and cached.
+type client struct {
+	provider      Provider
+	http          *http.Client
+	mu            sync.Mutex
+	discovery     *discovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+func newClient(provider Provider) *client {
+	return &client{provider: provider, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *client) discover() (discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return *c.discovery, nil
+	}
+
+	var document discovery
+
+	err := c.getJSON(strings.TrimRight(c.provider.Issuer, "/")+"/.well-known/openid-configuration", &document)
+
+	if err != nil {
+		return document, err
+	}
+
+	if document.Issuer != c.provider.Issuer {
+		return document, fmt.Errorf("provider %s reports issuer %q, expected %q", c.provider.Name, document.Issuer, c.provider.Issuer)
+	}
+
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JWKSURI == "" {
+		return document, fmt.Errorf("provider %s has an incomplete discovery document", c.provider.Name)
+	}
+
+	c.discovery = &document
+
+	return document, nil
+}
+
+func (c *client) authorizationURL(redirectURL string, state string, nonce string, codeChallenge string) (string, error) {
+	document, err := c.discover()
+
+	if err != nil {
+		return "", err
+	}
+
+	scopes := c.provider.Scopes
+
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", c.provider.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+
+	if strings.Contains(document.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return document.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// exchange redeems an authorization code and returns the raw ID token.
+func (c *client) exchange(code string, redirectURL string, codeVerifier string) (string, error) {
+	document, err := c.discover()
+
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("client_id", c.provider.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequest(http.MethodPost, document.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	if c.provider.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(c.provider.ClientID), url.QueryEscape(c.provider.ClientSecret))
+	}
+
+	response, err := c.http.Do(request)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&body)
+
+	if err != nil {
+		return "", fmt.Errorf("provider %s returned an unreadable token response: %s", c.provider.Name, err.Error())
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("provider %s rejected the authorization code: %s %s", c.provider.Name, body.Error, body.ErrorDescription)
+	}
+
+	if body.IDToken == "" {
+		return "", fmt.Errorf("provider %s did not return an ID token", c.provider.Name)
+	}
+
+	return body.IDToken, nil
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce.
+func (c *client) verify(idToken string, nonce string) (Claims, error) {
+	document, err := c.discover()
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.key(document, kid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA:
+			if _, ok := key.(*rsa.PublicKey); ok {
+				return key, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); ok {
+				return key, nil
+			}
+		}
+
+		return nil, errors.New("unexpected ID token signing algorithm")
+	})
+
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid ID token: %s", err.Error())
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok || !token.Valid {
+		return Claims{}, errors.New("invalid ID token")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return Claims{}, errors.New("ID token has no expiry")
+	}
+
+	if claims["iss"] != document.Issuer {
+		return Claims{}, errors.New("ID token was issued by another issuer")
+	}
+
+	if !hasAudience(claims, c.provider.ClientID) {
+		return Claims{}, errors.New("ID token was issued for another client")
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return Claims{}, errors.New("ID token nonce does not match")
+	}
+
+	result := Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	if result.Subject == "" {
+		return Claims{}, errors.New("ID token has no subject")
+	}
+
+	return result, nil
+}
+
+func hasAudience(claims jwt.MapClaims, clientID string) bool {
+	var audiences []string
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	found := false
+
+	for _, audience := range audiences {
+		if audience == clientID {
+			found = true
+		}
+	}
+
+	// With several audiences the token must name this client as the party
+	// it was issued to.
+	if azp, ok := claims["azp"].(string); ok && azp != clientID {
+		return false
+	}
+
+	if len(audiences) > 1 {
+		if _, ok := claims["azp"]; !ok {
+			return false
+		}
+	}
+
+	return found
+}
+
+func (c *client) key(document discovery, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(c.keysFetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	err := c.getJSON(document.JWKSURI, &set)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch {
+		case jwk.Kty == "RSA":
+			n, nErr := decodeBigInt(jwk.N)
+			e, eErr := decodeBigInt(jwk.E)
+
+			if nErr == nil && eErr == nil && e.IsInt64() {
+				keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+			}
+		case jwk.Kty == "EC" && jwk.Crv == "P-256":
+			x, xErr := decodeBigInt(jwk.X)
+			y, yErr := decodeBigInt(jwk.Y)
+
+			if xErr == nil && yErr == nil && elliptic.P256().IsOnCurve(x, y) {
+				keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+			}
+		}
+	}
+
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+
+	key, ok := keys[kid]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (c *client) getJSON(url string, value interface{}) error {
+	response, err := c.http.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s responded with %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,110 @@
+package oidc
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	SaveState(state LoginState) (LoginState, error)
+	ConsumeState(stateHash string) (LoginState, bool, error)
+	FindIdentity(provider string, subject string) (Identity, error)
+	FindIdentitiesByUserID(userID int) ([]Identity, error)
+	SaveIdentity(identity Identity) (Identity, error)
+	TouchIdentity(identity Identity, usedAt time.Time) error
+	DeleteIdentity(identity Identity) error
+	DeleteExpiredStates(now time.Time) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *repository {
+	return &repository{db}
+}
+
+func (r *repository) SaveState(state LoginState) (LoginState, error) {
+	err := r.db.Create(&state).Error
+
+	if err != nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+// ConsumeState deletes the state and returns it. It reports false when there
+// is no such state, including when a concurrent callback consumed it first.
+func (r *repository) ConsumeState(stateHash string) (LoginState, bool, error) {
+	var state LoginState
+	consumed := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("state_hash = ?", stateHash).Find(&state).Error
+
+		if err != nil || state.ID == 0 {
+			return err
+		}
+
+		result := tx.Delete(&LoginState{}, state.ID)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		consumed = result.RowsAffected > 0
+		return nil
+	})
+
+	if err != nil {
+		return state, false, err
+	}
+
+	return state, consumed, nil
+}
+
+func (r *repository) FindIdentity(provider string, subject string) (Identity, error) {
+	var identity Identity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).Find(&identity).Error
+
+	if err != nil {
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+func (r *repository) FindIdentitiesByUserID(userID int) ([]Identity, error) {
+	var identities []Identity
+	err := r.db.Where("user_id = ?", userID).Order("id asc").Find(&identities).Error
+
+	if err != nil {
+		return identities, err
+	}
+
+	return identities, nil
+}
+
+func (r *repository) SaveIdentity(identity Identity) (Identity, error) {
+	err := r.db.Create(&identity).Error
+
+	if err != nil {
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+func (r *repository) TouchIdentity(identity Identity, usedAt time.Time) error {
+	return r.db.Model(&Identity{}).Where("id = ?", identity.ID).Update("last_used_at", usedAt).Error
+}
+
+func (r *repository) DeleteIdentity(identity Identity) error {
+	return r.db.Delete(&Identity{}, identity.ID).Error
+}
+
+func (r *repository) DeleteExpiredStates(now time.Time) error {
+	return r.db.Where("expires_at < ?", now).Delete(&LoginState{}).Error
+}
@@ -0,0 +1,287 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const SandboxProvider = "sandbox"
+
+// sandboxCodeTTL is how long a sandbox authorization code can be redeemed.
+const sandboxCodeTTL = time.Minute
+
+// sandboxIssuer is a local stand-in for an OpenID Connect provider, like the
+// payment sandbox is for the payment gateway. Its authorize endpoint signs in
+// whichever email it is given in login_hint without asking anything, so the
+// whole flow, PKCE included, runs without an external service. Never enable
+// it in production.
+type sandboxIssuer struct {
+	issuer       string
+	clientSecret string
+	key          *rsa.PrivateKey
+	kid          string
+	mu           sync.Mutex
+	grants       map[string]sandboxGrant
+}
+
+type sandboxGrant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        Claims
+	expiresAt     time.Time
+}
+
+// NewSandboxIssuer serves the issuer at issuer, which must be the URL the
+// returned handler is mounted at.
+func NewSandboxIssuer(issuer string) (*sandboxIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clientSecret, err := randomString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := randomString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sandboxIssuer{
+		issuer:       issuer,
+		clientSecret: clientSecret,
+		key:          key,
+		kid:          kid[:16],
+		grants:       map[string]sandboxGrant{},
+	}, nil
+}
+
+// Provider returns the provider configuration that signs in with this issuer.
+func (s *sandboxIssuer) Provider() Provider {
+	return Provider{
+		Name:         SandboxProvider,
+		Issuer:       s.issuer,
+		ClientID:     SandboxProvider,
+		ClientSecret: s.clientSecret,
+	}
+}
+
+func (s *sandboxIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.discovery(w)
+	case "/jwks":
+		s.jwks(w)
+	case "/authorize":
+		s.authorize(w, r)
+	case "/token":
+		s.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *sandboxIssuer) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *sandboxIssuer) jwks(w http.ResponseWriter) {
+	public := s.key.PublicKey
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize grants a code for the email in login_hint. email_verified=false
+// and name can be passed to try other provider answers.
+func (s *sandboxIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != SandboxProvider || query.Get("response_type") != "code" {
+		http.Error(w, "unknown client or unsupported response_type", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "a PKCE S256 code_challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "redirect_uri must be an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	email := query.Get("login_hint")
+
+	if !strings.Contains(email, "@") {
+		http.Error(w, "login_hint must be the email to sign in as", http.StatusBadRequest)
+		return
+	}
+
+	code, err := randomString()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	subject := sha256.Sum256([]byte(strings.ToLower(email)))
+
+	grant := sandboxGrant{
+		redirectURI:   redirectURI.String(),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims: Claims{
+			Subject:       hex.EncodeToString(subject[:16]),
+			Email:         email,
+			EmailVerified: query.Get("email_verified") != "false",
+			Name:          query.Get("name"),
+		},
+		expiresAt: time.Now().Add(sandboxCodeTTL),
+	}
+
+	s.mu.Lock()
+	for unused, existing := range s.grants {
+		if time.Now().After(existing.expiresAt) {
+			delete(s.grants, unused)
+		}
+	}
+	s.grants[code] = grant
+	s.mu.Unlock()
+
+	callback := url.Values{}
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+
+	separator := "?"
+
+	if redirectURI.RawQuery != "" {
+		separator = "&"
+	}
+
+	http.Redirect(w, r, grant.redirectURI+separator+callback.Encode(), http.StatusFound)
+}
+
+func (s *sandboxIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+
+	if !ok || clientID != SandboxProvider || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+
+	s.mu.Lock()
+	grant, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(grant.expiresAt) || grant.redirectURI != r.PostFormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown, used or expired code"})
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier does not match"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.issuer,
+		"sub":            grant.claims.Subject,
+		"aud":            SandboxProvider,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.claims.Email,
+		"email_verified": grant.claims.EmailVerified,
+	}
+
+	if grant.claims.Name != "" {
+		claims["name"] = grant.claims.Name
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+
+	idToken, err := token.SignedString(s.key)
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := randomString()
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,357 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_crowdfund/user"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	Providers() []string
+	StartLogin(provider string) (Authorization, error)
+	StartLink(provider string, currentUser user.User) (Authorization, error)
+	CompleteLogin(provider string, input CallbackInput) (user.User, error)
+	LinkIdentity(provider string, input CallbackInput, currentUser user.User) (Identity, error)
+	UnlinkIdentity(provider string, currentUser user.User) error
+	GetIdentities(currentUser user.User) ([]Identity, error)
+	DeleteExpired(now time.Time) error
+}
+
+var (
+	ErrUnknownProvider = errors.New("Unknown sign-in provider")
+	ErrInvalidState    = errors.New("Invalid or expired sign-in attempt, please start again")
+)
+
+// stateTTL is how long the user has to finish signing in at the provider.
+const stateTTL = 10 * time.Minute
+
+// Authorization is where to send the user to sign in at a provider. The
+// frontend keeps State and checks the provider redirects back with it.
+type Authorization struct {
+	URL   string
+	State string
+}
+
+type service struct {
+	repository     Repository
+	userRepository user.Repository
+	clients        map[string]*client
+	redirectURL    string
+}
+
+// NewService signs users in with the given providers. redirectURL is the
+// frontend page providers send the user back to; it posts the code and
+// state from its query string to the callback endpoint.
+func NewService(repository Repository, userRepository user.Repository, providers []Provider, redirectURL string) *service {
+	clients := map[string]*client{}
+
+	for _, provider := range providers {
+		clients[provider.Name] = newClient(provider)
+	}
+
+	return &service{repository, userRepository, clients, redirectURL}
+}
+
+func (s *service) Providers() []string {
+	names := []string{}
+
+	for name := range s.clients {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *service) StartLogin(provider string) (Authorization, error) {
+	return s.start(provider, 0)
+}
+
+func (s *service) StartLink(provider string, currentUser user.User) (Authorization, error) {
+	return s.start(provider, currentUser.ID)
+}
+
+// CompleteLogin signs in the user linked to the provider account. A new
+// provider account is linked to the user with the same email, or to a new
+// user, but only when the provider vouches for the email. Accounts whose
+// email was never verified here are not linked automatically: whoever
+// registered them may not own the address.
+func (s *service) CompleteLogin(provider string, input CallbackInput) (user.User, error) {
+	claims, err := s.finish(provider, input, 0)
+
+	if err != nil {
+		return user.User{}, err
+	}
+
+	identity, err := s.repository.FindIdentity(provider, claims.Subject)
+
+	if err != nil {
+		return user.User{}, err
+	}
+
+	var account user.User
+
+	if identity.ID != 0 {
+		account, err = s.userRepository.FindById(identity.UserID)
+
+		if err != nil {
+			return account, err
+		}
+
+		if account.ID == 0 {
+			return account, errors.New("No user found for this sign-in")
+		}
+	} else {
+		account, err = s.accountFor(provider, claims)
+
+		if err != nil {
+			return account, err
+		}
+
+		identity = Identity{UserID: account.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+		identity, err = s.repository.SaveIdentity(identity)
+
+		if err != nil {
+			return account, err
+		}
+	}
+
+	if account.IsSuspended() {
+		return account, errors.New("This account has been suspended")
+	}
+
+	err = s.repository.TouchIdentity(identity, time.Now())
+
+	if err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (s *service) LinkIdentity(provider string, input CallbackInput, currentUser user.User) (Identity, error) {
+	claims, err := s.finish(provider, input, currentUser.ID)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity, err := s.repository.FindIdentity(provider, claims.Subject)
+
+	if err != nil {
+		return identity, err
+	}
+
+	if identity.ID != 0 {
+		if identity.UserID != currentUser.ID {
+			return Identity{}, errors.New("This account is already linked to another user")
+		}
+
+		return identity, nil
+	}
+
+	identities, err := s.repository.FindIdentitiesByUserID(currentUser.ID)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	for _, existing := range identities {
+		if existing.Provider == provider {
+			return Identity{}, fmt.Errorf("Another %s account is already linked, unlink it first", provider)
+		}
+	}
+
+	identity = Identity{UserID: currentUser.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+
+	newIdentity, err := s.repository.SaveIdentity(identity)
+
+	if err != nil {
+		return newIdentity, err
+	}
+
+	return newIdentity, nil
+}
+
+// UnlinkIdentity refuses to remove the last way a user without a password
+// can sign in.
+func (s *service) UnlinkIdentity(provider string, currentUser user.User) error {
+	identities, err := s.repository.FindIdentitiesByUserID(currentUser.ID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, identity := range identities {
+		if identity.Provider != provider {
+			continue
+		}
+
+		if len(identities) == 1 && !currentUser.HasPassword() {
+			return errors.New("Set a password before unlinking your last sign-in provider")
+		}
+
+		return s.repository.DeleteIdentity(identity)
+	}
+
+	return fmt.Errorf("No %s account is linked", provider)
+}
+
+func (s *service) GetIdentities(currentUser user.User) ([]Identity, error) {
+	identities, err := s.repository.FindIdentitiesByUserID(currentUser.ID)
+
+	if err != nil {
+		return identities, err
+	}
+
+	return identities, nil
+}
+
+func (s *service) DeleteExpired(now time.Time) error {
+	return s.repository.DeleteExpiredStates(now)
+}
+
+func (s *service) start(provider string, userID int) (Authorization, error) {
+	client, ok := s.clients[provider]
+
+	if !ok {
+		return Authorization{}, ErrUnknownProvider
+	}
+
+	state, err := randomString()
+
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	nonce, err := randomString()
+
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	codeVerifier, err := randomString()
+
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	authorizationURL, err := client.authorizationURL(s.redirectURL, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	loginState := LoginState{}
+	loginState.StateHash = hashState(state)
+	loginState.Provider = provider
+	loginState.CodeVerifier = codeVerifier
+	loginState.Nonce = nonce
+	loginState.UserID = userID
+	loginState.ExpiresAt = time.Now().Add(stateTTL)
+
+	_, err = s.repository.SaveState(loginState)
+
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	return Authorization{URL: authorizationURL, State: state}, nil
+}
+
+// finish redeems the callback of a flow started for userID at provider and
+// returns the verified ID token claims.
+func (s *service) finish(provider string, input CallbackInput, userID int) (Claims, error) {
+	client, ok := s.clients[provider]
+
+	if !ok {
+		return Claims{}, ErrUnknownProvider
+	}
+
+	state, ok, err := s.repository.ConsumeState(hashState(input.State))
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if !ok || state.Provider != provider || state.UserID != userID || time.Now().After(state.ExpiresAt) {
+		return Claims{}, ErrInvalidState
+	}
+
+	idToken, err := client.exchange(input.Code, s.redirectURL, state.CodeVerifier)
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	return client.verify(idToken, state.Nonce)
+}
+
+// accountFor returns the user a new provider account belongs to, creating
+// one when nobody has registered the email yet.
+func (s *service) accountFor(provider string, claims Claims) (user.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return user.User{}, fmt.Errorf("%s did not confirm your email address, so we cannot sign you in with it", provider)
+	}
+
+	account, err := s.userRepository.FindByEmail(claims.Email)
+
+	if err != nil {
+		return account, err
+	}
+
+	if account.ID != 0 {
+		if !account.IsVerified() {
+			return user.User{}, fmt.Errorf("An account with this email already exists. Sign in with your password, or reset it, and link %s from your profile", provider)
+		}
+
+		return account, nil
+	}
+
+	now := time.Now()
+
+	account.Name = claims.Name
+
+	if account.Name == "" {
+		account.Name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	account.Email = claims.Email
+	account.Role = user.RoleUser
+	account.EmailVerifiedAt = &now
+
+	newUser, err := s.userRepository.Save(account)
+
+	if err != nil {
+		return newUser, err
+	}
+
+	return newUser, nil
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+
+	_, err := rand.Read(buf)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
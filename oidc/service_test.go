@@ -0,0 +1,495 @@
+package oidc
+
+import (
+	"errors"
+	"go_crowdfund/user"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testRedirectURL = "https://app.example.com/auth/callback"
+
+type memoryRepository struct {
+	states     map[string]LoginState
+	identities []Identity
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{states: map[string]LoginState{}}
+}
+
+func (r *memoryRepository) SaveState(state LoginState) (LoginState, error) {
+	state.ID = len(r.states) + 1
+	r.states[state.StateHash] = state
+	return state, nil
+}
+
+func (r *memoryRepository) ConsumeState(stateHash string) (LoginState, bool, error) {
+	state, ok := r.states[stateHash]
+	delete(r.states, stateHash)
+	return state, ok, nil
+}
+
+func (r *memoryRepository) FindIdentity(provider string, subject string) (Identity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return Identity{}, nil
+}
+
+func (r *memoryRepository) FindIdentitiesByUserID(userID int) ([]Identity, error) {
+	identities := []Identity{}
+
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+
+	return identities, nil
+}
+
+func (r *memoryRepository) SaveIdentity(identity Identity) (Identity, error) {
+	identity.ID = len(r.identities) + 1
+	r.identities = append(r.identities, identity)
+	return identity, nil
+}
+
+func (r *memoryRepository) TouchIdentity(identity Identity, usedAt time.Time) error {
+	return nil
+}
+
+func (r *memoryRepository) DeleteIdentity(identity Identity) error {
+	return nil
+}
+
+func (r *memoryRepository) DeleteExpiredStates(now time.Time) error {
+	return nil
+}
+
+// memoryUserRepository implements the part of user.Repository signing in
+// uses; anything else panics.
+type memoryUserRepository struct {
+	user.Repository
+	users []user.User
+}
+
+func (r *memoryUserRepository) Save(account user.User) (user.User, error) {
+	account.ID = len(r.users) + 1
+	r.users = append(r.users, account)
+	return account, nil
+}
+
+func (r *memoryUserRepository) FindByEmail(email string) (user.User, error) {
+	for _, account := range r.users {
+		if account.Email == email {
+			return account, nil
+		}
+	}
+
+	return user.User{}, nil
+}
+
+func (r *memoryUserRepository) FindById(ID int) (user.User, error) {
+	for _, account := range r.users {
+		if account.ID == ID {
+			return account, nil
+		}
+	}
+
+	return user.User{}, nil
+}
+
+type sandboxSetup struct {
+	issuer     *sandboxIssuer
+	repository *memoryRepository
+	users      *memoryUserRepository
+	service    *service
+}
+
+func newSandboxSetup(t *testing.T) sandboxSetup {
+	var issuer *sandboxIssuer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	issuer, err := NewSandboxIssuer(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := newMemoryRepository()
+	users := &memoryUserRepository{}
+	service := NewService(repository, users, []Provider{issuer.Provider()}, testRedirectURL)
+
+	return sandboxSetup{issuer, repository, users, service}
+}
+
+// authorize signs in at the sandbox as email and returns the callback the
+// frontend would post. extra adds query parameters to the authorize URL.
+func authorize(t *testing.T, authorization Authorization, email string, extra url.Values) CallbackInput {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	query := url.Values{"login_hint": {email}}
+
+	for name, values := range extra {
+		query[name] = values
+	}
+
+	response, err := client.Get(authorization.URL + "&" + query.Encode())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("authorize responded with %d", response.StatusCode)
+	}
+
+	location, err := url.Parse(response.Header.Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(location.String(), testRedirectURL+"?") {
+		t.Fatalf("redirected to %s", location)
+	}
+
+	if location.Query().Get("state") != authorization.State {
+		t.Fatalf("state %q came back as %q", authorization.State, location.Query().Get("state"))
+	}
+
+	return CallbackInput{Code: location.Query().Get("code"), State: location.Query().Get("state")}
+}
+
+func (s sandboxSetup) storedState(t *testing.T, authorization Authorization) LoginState {
+	state, ok := s.repository.states[hashState(authorization.State)]
+
+	if !ok {
+		t.Fatal("login state was not stored")
+	}
+
+	return state
+}
+
+func TestCompleteLoginCreatesUserWithVerifiedEmail(t *testing.T) {
+	setup := newSandboxSetup(t)
+
+	authorization, err := setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizationURL, err := url.Parse(authorization.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := authorizationURL.Query()
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("nonce") == "" {
+		t.Fatalf("authorization URL lacks PKCE or nonce: %s", authorization.URL)
+	}
+
+	if query.Get("code_challenge") == setup.storedState(t, authorization).CodeVerifier {
+		t.Fatal("the code verifier was sent to the provider")
+	}
+
+	callback := authorize(t, authorization, "ana@example.com", url.Values{"name": {"Ana"}})
+
+	account, err := setup.service.CompleteLogin(SandboxProvider, callback)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID == 0 || account.Email != "ana@example.com" || account.Name != "Ana" || !account.IsVerified() {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	if len(setup.repository.identities) != 1 || setup.repository.identities[0].UserID != account.ID {
+		t.Fatalf("identity not linked: %+v", setup.repository.identities)
+	}
+
+	again, err := setup.service.CompleteLogin(SandboxProvider, callback)
+
+	if err != ErrInvalidState {
+		t.Fatalf("reused callback signed in %+v, err %v", again, err)
+	}
+
+	authorization, err = setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	returning, err := setup.service.CompleteLogin(SandboxProvider, authorize(t, authorization, "ana@example.com", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if returning.ID != account.ID || len(setup.users.users) != 1 {
+		t.Fatalf("returning sign-in got user %d, %d users exist", returning.ID, len(setup.users.users))
+	}
+}
+
+func TestCompleteLoginLinksOnlyVerifiedEmails(t *testing.T) {
+	setup := newSandboxSetup(t)
+	verifiedAt := time.Now()
+
+	verified, _ := setup.users.Save(user.User{Name: "Verified", Email: "verified@example.com", EmailVerifiedAt: &verifiedAt})
+	setup.users.Save(user.User{Name: "Unverified", Email: "unverified@example.com"})
+
+	authorization, err := setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := setup.service.CompleteLogin(SandboxProvider, authorize(t, authorization, "verified@example.com", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID != verified.ID {
+		t.Fatalf("signed in as user %d, expected the existing user %d", account.ID, verified.ID)
+	}
+
+	authorization, err = setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = setup.service.CompleteLogin(SandboxProvider, authorize(t, authorization, "unverified@example.com", nil))
+
+	if err == nil {
+		t.Fatal("signed in to an account whose email was never verified")
+	}
+
+	authorization, err = setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = setup.service.CompleteLogin(SandboxProvider, authorize(t, authorization, "new@example.com", url.Values{"email_verified": {"false"}}))
+
+	if err == nil {
+		t.Fatal("signed in with an email the provider did not verify")
+	}
+
+	if len(setup.repository.identities) != 1 || len(setup.users.users) != 2 {
+		t.Fatalf("rejected sign-ins left %d identities and %d users behind", len(setup.repository.identities), len(setup.users.users))
+	}
+}
+
+func TestCompleteLoginRequiresCodeVerifier(t *testing.T) {
+	setup := newSandboxSetup(t)
+
+	authorization, err := setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := authorize(t, authorization, "ana@example.com", nil)
+
+	state := setup.storedState(t, authorization)
+	state.CodeVerifier = "not-the-verifier"
+	setup.repository.states[state.StateHash] = state
+
+	_, err = setup.service.CompleteLogin(SandboxProvider, callback)
+
+	if err == nil || !strings.Contains(err.Error(), "rejected the authorization code") {
+		t.Fatalf("expected the code exchange to fail, got %v", err)
+	}
+}
+
+func TestCompleteLoginRequiresNonce(t *testing.T) {
+	setup := newSandboxSetup(t)
+
+	authorization, err := setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := authorize(t, authorization, "ana@example.com", nil)
+
+	state := setup.storedState(t, authorization)
+	state.Nonce = "another-nonce"
+	setup.repository.states[state.StateHash] = state
+
+	_, err = setup.service.CompleteLogin(SandboxProvider, callback)
+
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("expected a nonce mismatch, got %v", err)
+	}
+}
+
+func TestVerifyChecksAudienceAndIssuer(t *testing.T) {
+	setup := newSandboxSetup(t)
+	client := setup.service.clients[SandboxProvider]
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = setup.issuer.kid
+
+		signed, err := token.SignedString(setup.issuer.key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":   setup.issuer.issuer,
+			"sub":   "subject",
+			"aud":   SandboxProvider,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+
+		for name, value := range overrides {
+			claims[name] = value
+		}
+
+		return claims
+	}
+
+	_, err := client.verify(sign(claims(nil)), "nonce")
+
+	if err != nil {
+		t.Fatalf("valid ID token rejected: %v", err)
+	}
+
+	cases := map[string]jwt.MapClaims{
+		"another audience":                     {"aud": "another-client"},
+		"several audiences without azp":        {"aud": []string{SandboxProvider, "another-client"}},
+		"several audiences for another client": {"aud": []string{SandboxProvider, "another-client"}, "azp": "another-client"},
+		"another issuer":                       {"iss": "https://issuer.example.com"},
+		"expired":                              {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no subject":                           {"sub": ""},
+	}
+
+	for name, overrides := range cases {
+		_, err := client.verify(sign(claims(overrides)), "nonce")
+
+		if err == nil {
+			t.Errorf("%s: ID token accepted", name)
+		}
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	setup := newSandboxSetup(t)
+	verifiedAt := time.Now()
+
+	owner, _ := setup.users.Save(user.User{Name: "Owner", Email: "owner@example.com", EmailVerifiedAt: &verifiedAt})
+	other, _ := setup.users.Save(user.User{Name: "Other", Email: "other@example.com", EmailVerifiedAt: &verifiedAt})
+
+	// A sign-in state cannot be used to link, nor one started by someone
+	// else.
+	authorization, err := setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = setup.service.LinkIdentity(SandboxProvider, authorize(t, authorization, "someone@example.com", nil), owner)
+
+	if err != ErrInvalidState {
+		t.Fatalf("linked with a sign-in state, err %v", err)
+	}
+
+	authorization, err = setup.service.StartLink(SandboxProvider, other)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = setup.service.LinkIdentity(SandboxProvider, authorize(t, authorization, "someone@example.com", nil), owner)
+
+	if err != ErrInvalidState {
+		t.Fatalf("linked with another user's state, err %v", err)
+	}
+
+	// Linking does not need the provider's email to match, or be verified.
+	authorization, err = setup.service.StartLink(SandboxProvider, owner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := setup.service.LinkIdentity(SandboxProvider, authorize(t, authorization, "someone@example.com", url.Values{"email_verified": {"false"}}), owner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.UserID != owner.ID || identity.Email != "someone@example.com" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	authorization, err = setup.service.StartLink(SandboxProvider, other)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = setup.service.LinkIdentity(SandboxProvider, authorize(t, authorization, "someone@example.com", nil), other)
+
+	if err == nil {
+		t.Fatal("linked an account that belongs to another user")
+	}
+
+	authorization, err = setup.service.StartLogin(SandboxProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := setup.service.CompleteLogin(SandboxProvider, authorize(t, authorization, "someone@example.com", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.ID != owner.ID {
+		t.Fatalf("linked account signed in as user %d, expected %d", account.ID, owner.ID)
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	setup := newSandboxSetup(t)
+
+	_, err := setup.service.StartLogin("nope")
+
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package payment
+
+import "time"
+
+// PaymentExpiry is how long a payment page accepts payment. Pending pledges
+// are expired some time after it, so no late payment can outlive its pledge.
+const PaymentExpiry = 24 * time.Hour
+
+const (
+	StatusPaid    = "paid"
+	StatusPending = "pending"
+	StatusExpired = "expired"
+	StatusFailed  = "failed"
+)
+
+type Transaction struct {
+	ID     int
+	Code   string
+	Amount int
+}
+
+type Notification struct {
+	OrderID     string `json:"order_id"`
+	Status      string `json:"status"`
+	GrossAmount int    `json:"gross_amount"`
+}
+
+type Refund struct {
+	ID              int
+	TransactionCode string
+	Amount          int
+}
@@ -0,0 +1,18 @@
+package payment
+
+import (
+	"go_crowdfund/user"
+	"net/http"
+)
+
+type Gateway interface {
+	GetPaymentURL(transaction Transaction, user user.User) (string, error)
+	ParseNotification(header http.Header, body []byte) (Notification, error)
+	Refund(refund Refund) (string, error)
+}
+
+type Sandbox interface {
+	Gateway
+	GetPayment(code string) (Transaction, bool)
+	Simulate(code string, status string) error
+}
@@ -0,0 +1,9 @@
+package payment
+
+type SandboxPaymentInput struct {
+	Token string `uri:"token" binding:"required"`
+}
+
+type SandboxSettleInput struct {
+	Status string `json:"status" binding:"required,oneof=paid pending expired failed"`
+}
@@ -0,0 +1,169 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_crowdfund/user"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SandboxSignatureHeader = "X-Sandbox-Signature"
+
+// sandboxGateway is a local stand-in for a real payment provider. It hands out
+// payment URLs served by this app and delivers HMAC-signed callbacks to the
+// notification webhook, so the whole flow runs without an external service.
+// It keeps no state: payment URLs carry a signed token with the transaction
+// code and amount, so they survive restarts and work across replicas.
+type sandboxGateway struct {
+	secret  []byte
+	baseURL string
+	client  *http.Client
+}
+
+func NewSandboxGateway(secret []byte, baseURL string) *sandboxGateway {
+	return &sandboxGateway{
+		secret:  secret,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *sandboxGateway) GetPaymentURL(transaction Transaction, user user.User) (string, error) {
+	if transaction.Code == "" || strings.Contains(transaction.Code, ".") {
+		return "", errors.New("transaction code is required and must not contain dots")
+	}
+
+	payload := transaction.Code + "." + strconv.Itoa(transaction.Amount)
+	token := payload + "." + hex.EncodeToString(g.sign([]byte("payment:"+payload)))
+
+	return fmt.Sprintf("%s/sandbox/payments/%s", g.baseURL, token), nil
+}
+
+func (g *sandboxGateway) ParseNotification(header http.Header, body []byte) (Notification, error) {
+	var notification Notification
+
+	signature, err := hex.DecodeString(header.Get(SandboxSignatureHeader))
+
+	if err != nil || !hmac.Equal(signature, g.sign(body)) {
+		return notification, errors.New("invalid notification signature")
+	}
+
+	err = json.Unmarshal(body, &notification)
+
+	if err != nil {
+		return notification, err
+	}
+
+	switch notification.Status {
+	case StatusPaid, StatusPending, StatusExpired, StatusFailed:
+		return notification, nil
+	}
+
+	return notification, fmt.Errorf("unknown payment status %q", notification.Status)
+}
+
+// Refund is idempotent on the refund ID, like the idempotency keys real
+// providers accept, so a retried refund never pays out twice.
+func (g *sandboxGateway) Refund(refund Refund) (string, error) {
+	if refund.Amount <= 0 {
+		return "", errors.New("refund amount must be positive")
+	}
+
+	return fmt.Sprintf("REFUND-%s-%d", refund.TransactionCode, refund.ID), nil
+}
+
+// GetPayment returns the transaction a payment token from GetPaymentURL was
+// issued for.
+func (g *sandboxGateway) GetPayment(token string) (Transaction, bool) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return Transaction{}, false
+	}
+
+	signature, err := hex.DecodeString(parts[2])
+
+	if err != nil || !hmac.Equal(signature, g.sign([]byte("payment:"+parts[0]+"."+parts[1]))) {
+		return Transaction{}, false
+	}
+
+	amount, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return Transaction{}, false
+	}
+
+	return Transaction{Code: parts[0], Amount: amount}, true
+}
+
+// SignNotification returns the callback body and the signature header value
+// the sandbox sends for the given notification.
+func (g *sandboxGateway) SignNotification(notification Notification) ([]byte, string, error) {
+	body, err := json.Marshal(notification)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, hex.EncodeToString(g.sign(body)), nil
+}
+
+// Simulate settles a payment issued by GetPaymentURL with the given status and
+// posts the signed callback to the notification webhook.
+func (g *sandboxGateway) Simulate(token string, status string) error {
+	transaction, ok := g.GetPayment(token)
+
+	if !ok {
+		return errors.New("No payment found with that code")
+	}
+
+	notification := Notification{
+		OrderID:     transaction.Code,
+		Status:      status,
+		GrossAmount: transaction.Amount,
+	}
+
+	body, signature, err := g.SignNotification(notification)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, g.baseURL+"/api/v1/transactions/notification", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SandboxSignatureHeader, signature)
+
+	response, err := g.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("notification webhook responded with %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func (g *sandboxGateway) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"errors"
+	"go_crowdfund/user"
+)
+
+const (
+	CampaignCreate   = "campaign:create"
+	CampaignUpdate   = "campaign:update"
+	CampaignView     = "campaign:view"
+	CampaignSubmit   = "campaign:submit"
+	CampaignCancel   = "campaign:cancel"
+	CampaignApprove  = "campaign:approve"
+	CampaignReject   = "campaign:reject"
+	CampaignFeature  = "campaign:feature"
+	CampaignTakeDown = "campaign:take_down"
+	CategoryManage   = "category:manage"
+	PledgeCreate     = "pledge:create"
+	RoleManage       = "role:manage"
+	UserSuspend      = "user:suspend"
+	UserList         = "user:list"
+	TransactionView  = "transaction:view"
+	AuditView        = "audit:view"
+	AdminAccess      = "admin:access"
+
+	// anySuffix turns an owner-scoped permission into one that applies to
+	// resources owned by anybody, e.g. campaign:update:any.
+	anySuffix = ":any"
+)
+
+var (
+	ErrForbidden        = errors.New("You are not allowed to do that")
+	ErrEmailNotVerified = errors.New("Please verify your email address first")
+)
+
+// verifiedPermissions are only granted once the user verified their email,
+// whatever their roles.
+var verifiedPermissions = map[string]bool{
+	CampaignCreate: true,
+	PledgeCreate:   true,
+}
+
+var ownerPermissions = []string{
+	CampaignCreate,
+	CampaignUpdate,
+	CampaignView,
+	CampaignSubmit,
+	CampaignCancel,
+	PledgeCreate,
+}
+
+// rolePermissions lists what each role may do. A user holding several roles
+// gets the union. Owner-scoped permissions only apply to the user's own
+// resources unless the role also holds the :any variant.
+var rolePermissions = map[string][]string{
+	user.RoleUser:    ownerPermissions,
+	user.RoleCreator: ownerPermissions,
+	user.RoleModerator: {
+		CampaignView + anySuffix,
+		CampaignCancel + anySuffix,
+		CampaignApprove,
+		CampaignReject,
+	},
+	user.RoleAdmin: {
+		CampaignView + anySuffix,
+		CampaignUpdate + anySuffix,
+		CampaignCancel + anySuffix,
+		CampaignApprove,
+		CampaignReject,
+		CampaignFeature,
+		CampaignTakeDown,
+		CategoryManage,
+		RoleManage,
+		UserSuspend,
+		UserList,
+		TransactionView + anySuffix,
+		AuditView,
+		AdminAccess,
+	},
+}
+
+// Can reports whether any of currentUser's roles grants permission.
+func Can(currentUser user.User, permission string) bool {
+	if verifiedPermissions[permission] && !currentUser.IsVerified() {
+		return false
+	}
+
+	for _, role := range currentUser.Roles() {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CanOnOwned reports whether currentUser may use permission on a resource
+// owned by ownerID: owners need the permission itself, everybody else its
+// :any variant.
+func CanOnOwned(currentUser user.User, permission string, ownerID int) bool {
+	if currentUser.ID != 0 && currentUser.ID == ownerID && Can(currentUser, permission) {
+		return true
+	}
+
+	return Can(currentUser, permission+anySuffix)
+}
+
+func Authorize(currentUser user.User, permission string) error {
+	if verifiedPermissions[permission] && !currentUser.IsVerified() {
+		return ErrEmailNotVerified
+	}
+
+	if !Can(currentUser, permission) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func AuthorizeOwned(currentUser user.User, permission string, ownerID int) error {
+	if !CanOnOwned(currentUser, permission, ownerID) {
+		return ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"go_crowdfund/user"
+	"testing"
+	"time"
+)
+
+func TestUnverifiedUsersCannotCreateOrPledge(t *testing.T) {
+	unverified := user.User{ID: 1, Role: user.RoleUser}
+
+	verifiedAt := time.Now()
+	verified := user.User{ID: 2, Role: user.RoleUser, EmailVerifiedAt: &verifiedAt}
+
+	for _, permission := range []string{CampaignCreate, PledgeCreate} {
+		if err := Authorize(unverified, permission); err != ErrEmailNotVerified {
+			t.Errorf("%s: unverified user got %v", permission, err)
+		}
+
+		if err := Authorize(verified, permission); err != nil {
+			t.Errorf("%s: verified user got %v", permission, err)
+		}
+	}
+
+	// Only creating and pledging need a verified email.
+	if err := AuthorizeOwned(unverified, CampaignUpdate, unverified.ID); err != nil {
+		t.Errorf("unverified owner cannot update their campaign: %v", err)
+	}
+}
+
+func TestOnlyReviewersApproveCampaigns(t *testing.T) {
+	verifiedAt := time.Now()
+
+	for _, role := range user.Roles {
+		member := user.User{ID: 1, Role: role, EmailVerifiedAt: &verifiedAt}
+		reviewer := role == user.RoleModerator || role == user.RoleAdmin
+
+		if Can(member, CampaignApprove) != reviewer {
+			t.Errorf("%s: can approve campaigns is %v", role, !reviewer)
+		}
+	}
+}
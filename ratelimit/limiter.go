@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate allows Limit requests per Window.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRate reads a rate written as "<limit>/<window>", e.g. "20/1m".
+func ParseRate(value string) (Rate, error) {
+	parts := strings.SplitN(value, "/", 2)
+
+	if len(parts) != 2 {
+		return Rate{}, errors.New("rate must look like 20/1m")
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+
+	if err != nil || limit <= 0 {
+		return Rate{}, errors.New("rate limit must be a positive number")
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+
+	if err != nil || window <= 0 {
+		return Rate{}, errors.New("rate window must be a positive duration")
+	}
+
+	return Rate{limit, window}, nil
+}
+
+func (r Rate) String() string {
+	return strconv.Itoa(r.Limit) + "/" + r.Window.String()
+}
+
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store}
+}
+
+// Allow counts a request against the bucket at key. When the bucket is
+// exhausted it returns false and how long until it refills.
+func (l *Limiter) Allow(key string, rate Rate, now time.Time) (bool, time.Duration, error) {
+	count, resetAt, err := l.store.Increment("rate:"+key, rate.Window, now)
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count > rate.Limit {
+		return false, resetAt.Sub(now), nil
+	}
+
+	return true, 0, nil
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import "time"
+
+// failureWindow is how long failed attempts on an account are remembered.
+const failureWindow = 24 * time.Hour
+
+// Lockout locks an account after repeated failures. The first lock after
+// threshold failures lasts base; every further failure doubles it, up to max.
+type Lockout struct {
+	store     Store
+	threshold int
+	base      time.Duration
+	max       time.Duration
+}
+
+func NewLockout(store Store, threshold int, base time.Duration, max time.Duration) *Lockout {
+	return &Lockout{store, threshold, base, max}
+}
+
+// LockedFor returns how long account stays locked, zero when it is not.
+func (l *Lockout) LockedFor(account string, now time.Time) (time.Duration, error) {
+	until, err := l.store.LockedUntil("lock:"+account, now)
+
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+
+	return until.Sub(now), nil
+}
+
+// Fail records a failed attempt and returns how long account is now locked.
+func (l *Lockout) Fail(account string, now time.Time) (time.Duration, error) {
+	failures, _, err := l.store.Increment("failures:"+account, failureWindow, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if failures < l.threshold {
+		return 0, nil
+	}
+
+	lockFor := l.base
+	for i := l.threshold; i < failures && lockFor < l.max; i++ {
+		lockFor *= 2
+	}
+
+	if lockFor > l.max {
+		lockFor = l.max
+	}
+
+	return lockFor, l.store.Lock("lock:"+account, now.Add(lockFor))
+}
+
+func (l *Lockout) Reset(account string) error {
+	err := l.store.Reset("failures:" + account)
+
+	if err != nil {
+		return err
+	}
+
+	return l.store.Reset("lock:" + account)
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps rate limit counters and lockouts. It is an interface so several
+// instances can share one backend, e.g. Redis with INCR and EXPIRE.
+type Store interface {
+	// Increment adds one to the counter at key and returns the new count and
+	// when the counter resets. A new counter resets ttl from now;
+	// incrementing does not extend it.
+	Increment(key string, ttl time.Duration, now time.Time) (int, time.Time, error)
+	Lock(key string, until time.Time) error
+	// LockedUntil returns the zero time when key is not locked.
+	LockedUntil(key string, now time.Time) (time.Time, error)
+	// Reset clears both the counter and the lock at key.
+	Reset(key string) error
+}
+
+type counter struct {
+	count   int
+	resetAt time.Time
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]counter
+	locks     map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{counters: map[string]counter{}, locks: map[string]time.Time{}}
+}
+
+func (s *memoryStore) Increment(key string, ttl time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+
+	if !ok || !now.Before(c.resetAt) {
+		c = counter{resetAt: now.Add(ttl)}
+	}
+
+	c.count++
+	s.counters[key] = c
+
+	return c.count, c.resetAt, nil
+}
+
+func (s *memoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = until
+
+	return nil
+}
+
+func (s *memoryStore) LockedUntil(key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+
+	if !ok || !now.Before(until) {
+		return time.Time{}, nil
+	}
+
+	return until, nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	delete(s.locks, key)
+
+	return nil
+}
+
+// sweep drops expired entries at most once a minute so the maps do not grow
+// with every address that ever made a request.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	s.lastSweep = now
+
+	for key, c := range s.counters {
+		if !now.Before(c.resetAt) {
+			delete(s.counters, key)
+		}
+	}
+
+	for key, until := range s.locks {
+		if !now.Before(until) {
+			delete(s.locks, key)
+		}
+	}
+}
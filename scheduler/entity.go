@@ -0,0 +1,10 @@
+package scheduler
+
+import "time"
+
+type Lease struct {
+	Name      string `gorm:"primaryKey;size:100"`
+	Owner     string `gorm:"size:100"`
+	ExpiresAt time.Time
+	UpdatedAt time.Time
+}
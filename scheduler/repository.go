@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	AcquireLease(name string, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(name string, owner string) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *repository {
+	return &repository{db}
+}
+
+// AcquireLease takes or renews the named lease for owner. It only succeeds
+// when nobody else holds an unexpired lease, so a job guarded by it runs on
+// a single replica at a time.
+func (r *repository) AcquireLease(name string, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	result := r.db.Model(&Lease{}).
+		Where("name = ? AND (owner = ? OR expires_at < ?)", name, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "expires_at": now.Add(ttl)})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	lease := Lease{Name: name, Owner: owner, ExpiresAt: now.Add(ttl)}
+	result = r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *repository) ReleaseLease(name string, owner string) error {
+	return r.db.Model(&Lease{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Update("expires_at", time.Time{}).Error
+}
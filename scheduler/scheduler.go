@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Job func(ctx context.Context) error
+
+type task struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+type scheduler struct {
+	repository Repository
+	owner      string
+	tasks      []task
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func NewScheduler(repository Repository) *scheduler {
+	return &scheduler{repository: repository, owner: instanceName()}
+}
+
+// Every registers job to run once per interval. Each run first takes the
+// job's lease, so with several replicas only one of them runs it.
+func (s *scheduler) Every(name string, interval time.Duration, job Job) {
+	s.tasks = append(s.tasks, task{name, interval, job})
+}
+
+func (s *scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(ctx, t)
+	}
+}
+
+// Shutdown stops scheduling new runs and waits for running jobs to finish
+// or for ctx to expire.
+func (s *scheduler) Shutdown(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, t := range s.tasks {
+		err := s.repository.ReleaseLease(t.name, s.owner)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *scheduler) loop(ctx context.Context, t task) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		s.run(ctx, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *scheduler) run(ctx context.Context, t task) {
+	acquired, err := s.repository.AcquireLease(t.name, s.owner, t.interval)
+
+	if err != nil {
+		log.Printf("scheduler: acquire lease %s: %v", t.name, err)
+		return
+	}
+
+	if !acquired {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, t.interval)
+	defer cancel()
+
+	err = t.job(runCtx)
+
+	if err != nil {
+		log.Printf("scheduler: job %s: %v", t.name, err)
+	}
+}
+
+func instanceName() string {
+	hostname, _ := os.Hostname()
+	random := make([]byte, 4)
+	rand.Read(random)
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(random))
+}
@@ -0,0 +1,151 @@
+package search
+
+import (
+	"go_crowdfund/campaign"
+	"math"
+	"sort"
+	"sync"
+)
+
+var fieldWeights = map[string]float64{
+	"name":              3,
+	"short_description": 2,
+	"description":       1,
+}
+
+type document struct {
+	name             string
+	shortDescription string
+	description      string
+	terms            map[string]float64
+}
+
+// memoryIndex is an in-process inverted index ranked by weighted TF-IDF. It
+// needs no database support, which makes it the backend for tests and for
+// deployments on databases without full-text indexes such as SQLite.
+type memoryIndex struct {
+	mu        sync.RWMutex
+	documents map[int]document
+	postings  map[string]map[int]float64
+}
+
+func NewMemoryIndex() *memoryIndex {
+	return &memoryIndex{
+		documents: map[int]document{},
+		postings:  map[string]map[int]float64{},
+	}
+}
+
+func (m *memoryIndex) Index(campaign campaign.Campaign) error {
+	doc := document{
+		name:             campaign.Name,
+		shortDescription: campaign.ShortDescription,
+		description:      campaign.Description,
+		terms:            map[string]float64{},
+	}
+
+	fields := map[string]string{
+		"name":              campaign.Name,
+		"short_description": campaign.ShortDescription,
+		"description":       campaign.Description,
+	}
+
+	for field, text := range fields {
+		for _, t := range tokenize(text) {
+			doc.terms[t.text] += fieldWeights[field]
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(campaign.ID)
+	m.documents[campaign.ID] = doc
+
+	for term, weight := range doc.terms {
+		if m.postings[term] == nil {
+			m.postings[term] = map[int]float64{}
+		}
+
+		m.postings[term][campaign.ID] = weight
+	}
+
+	return nil
+}
+
+func (m *memoryIndex) Remove(campaignID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(campaignID)
+
+	return nil
+}
+
+func (m *memoryIndex) Search(query string, limit int) ([]campaign.SearchHit, error) {
+	terms := Terms(query)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := map[int]float64{}
+	total := float64(len(m.documents))
+
+	for _, term := range terms {
+		postings := m.postings[term]
+
+		if len(postings) == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + total/float64(len(postings)))
+
+		for ID, weight := range postings {
+			scores[ID] += (1 + math.Log(weight)) * idf
+		}
+	}
+
+	hits := []campaign.SearchHit{}
+
+	for ID, score := range scores {
+		doc := m.documents[ID]
+
+		hits = append(hits, campaign.SearchHit{
+			CampaignID: ID,
+			Score:      score,
+			Highlights: highlights(doc.name, doc.shortDescription, doc.description, terms),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+
+		return hits[i].CampaignID > hits[j].CampaignID
+	})
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits, nil
+}
+
+func (m *memoryIndex) remove(campaignID int) {
+	doc, ok := m.documents[campaignID]
+
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(m.postings[term], campaignID)
+
+		if len(m.postings[term]) == 0 {
+			delete(m.postings, term)
+		}
+	}
+
+	delete(m.documents, campaignID)
+}
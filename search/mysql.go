@@ -0,0 +1,75 @@
+package search
+
+import (
+	"go_crowdfund/campaign"
+
+	"gorm.io/gorm"
+)
+
+const fulltextIndexName = "idx_campaigns_fulltext"
+
+// mysqlIndex searches the campaigns table through a MySQL FULLTEXT index, so
+// there is nothing to keep in sync and Index and Remove are no-ops.
+type mysqlIndex struct {
+	db *gorm.DB
+}
+
+type mysqlHit struct {
+	ID               int
+	Name             string
+	ShortDescription string
+	Description      string
+	Score            float64
+}
+
+func NewMySQLIndex(db *gorm.DB) *mysqlIndex {
+	return &mysqlIndex{db}
+}
+
+// EnsureIndex creates the FULLTEXT index on the searchable campaign columns
+// when it does not exist yet.
+func (m *mysqlIndex) EnsureIndex() error {
+	if m.db.Migrator().HasIndex(&campaign.Campaign{}, fulltextIndexName) {
+		return nil
+	}
+
+	return m.db.Exec("ALTER TABLE campaigns ADD FULLTEXT " + fulltextIndexName + " (name, short_description, description)").Error
+}
+
+func (m *mysqlIndex) Index(campaign campaign.Campaign) error {
+	return nil
+}
+
+func (m *mysqlIndex) Remove(campaignID int) error {
+	return nil
+}
+
+func (m *mysqlIndex) Search(query string, limit int) ([]campaign.SearchHit, error) {
+	var rows []mysqlHit
+
+	match := "MATCH (name, short_description, description) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+	err := m.db.Model(&campaign.Campaign{}).
+		Select("id, name, short_description, description, "+match+" AS score", query).
+		Where(match, query).
+		Order("score desc").
+		Limit(limit).
+		Scan(&rows).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	terms := Terms(query)
+	hits := []campaign.SearchHit{}
+
+	for _, row := range rows {
+		hits = append(hits, campaign.SearchHit{
+			CampaignID: row.ID,
+			Score:      row.Score,
+			Highlights: highlights(row.Name, row.ShortDescription, row.Description, terms),
+		})
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,147 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	text  string
+	start int
+	end   int
+}
+
+func tokenize(text string) []token {
+	tokens := []token{}
+	start := -1
+
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+
+		if isWord && start < 0 {
+			start = i
+		}
+
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+
+	return tokens
+}
+
+func Terms(query string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+
+	for _, t := range tokenize(query) {
+		if len(t.text) < 2 || seen[t.text] {
+			continue
+		}
+
+		seen[t.text] = true
+		terms = append(terms, t.text)
+	}
+
+	return terms
+}
+
+const snippetLength = 160
+
+// Highlight returns an HTML-escaped snippet of text around the first match of
+// any of terms, with matches wrapped in <mark>. It returns "" when nothing
+// matches.
+func Highlight(text string, terms []string) string {
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	tokens := tokenize(text)
+	first := -1
+
+	for i, t := range tokens {
+		if wanted[t.text] {
+			first = i
+			break
+		}
+	}
+
+	if first < 0 {
+		return ""
+	}
+
+	from := first
+	for from > 0 && tokens[first].start-tokens[from-1].start < snippetLength/3 {
+		from--
+	}
+
+	start := tokens[from].start
+	end := len(text)
+
+	if end-start > snippetLength {
+		end = start + snippetLength
+
+		for end < len(text) && end > tokens[first].end && !unicode.IsSpace(rune(text[end])) {
+			end--
+		}
+	}
+
+	var snippet strings.Builder
+
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+
+	cursor := start
+
+	for _, t := range tokens[from:] {
+		if t.end > end {
+			break
+		}
+
+		if !wanted[t.text] {
+			continue
+		}
+
+		snippet.WriteString(html.EscapeString(text[cursor:t.start]))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(text[t.start:t.end]))
+		snippet.WriteString("</mark>")
+		cursor = t.end
+	}
+
+	snippet.WriteString(html.EscapeString(text[cursor:end]))
+
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+
+	return snippet.String()
+}
+
+func highlights(name string, shortDescription string, description string, terms []string) map[string]string {
+	result := map[string]string{}
+
+	fields := map[string]string{
+		"name":              name,
+		"short_description": shortDescription,
+		"description":       description,
+	}
+
+	for field, text := range fields {
+		snippet := Highlight(text, terms)
+
+		if snippet != "" {
+			result[field] = snippet
+		}
+	}
+
+	return result
+}
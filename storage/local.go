@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localBackend keeps files in a directory on this machine and serves them
+// itself, so it only suits a single instance.
+type localBackend struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalBackend stores files under root. baseURL is where the backend, as
+// an http.Handler, is mounted; secret signs the URLs from SignedURL.
+func NewLocalBackend(root string, baseURL string, secret []byte) *localBackend {
+	return &localBackend{root, strings.TrimRight(baseURL, "/"), secret}
+}
+
+// Put writes to a temporary file first, so readers never see a half
+// written file.
+func (b *localBackend) Put(key string, body io.Reader, contentType string) error {
+	err := validateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	destination := b.path(key)
+
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(destination), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, body)
+
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), destination)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (b *localBackend) Get(key string) (Object, error) {
+	err := validateKey(key)
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	file, err := os.Open(b.path(key))
+
+	if os.IsNotExist(err) {
+		return Object{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return Object{}, err
+	}
+
+	if info.IsDir() {
+		file.Close()
+		return Object{}, ErrNotFound
+	}
+
+	object := Object{}
+	object.Body = file
+	object.ContentType = contentTypeOf(key)
+	object.Size = info.Size()
+	object.LastModified = info.ModTime()
+
+	return object, nil
+}
+
+func (b *localBackend) Delete(key string) error {
+	err := validateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(b.path(key))
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *localBackend) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return b.baseURL + "/" + escapeKey(key)
+}
+
+func (b *localBackend) SignedURL(key string, ttl time.Duration) (string, error) {
+	err := validateKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	return b.URL(key) + "?expires=" + expires + "&signature=" + b.sign(key, expires), nil
+}
+
+// ServeHTTP serves stored files. A request carrying a signature must have a
+// valid, unexpired one.
+func (b *localBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	if query.Has("signature") {
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+		if err != nil || time.Now().Unix() > expires || !hmac.Equal([]byte(query.Get("signature")), []byte(b.sign(key, query.Get("expires")))) {
+			http.Error(w, "invalid or expired signature", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+
+	object, err := b.Get(key)
+
+	if err == ErrNotFound || err == ErrInvalidKey {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	defer object.Body.Close()
+
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, path.Base(key), object.LastModified, object.Body.(*os.File))
+}
+
+func (b *localBackend) path(key string) string {
+	return filepath.Join(b.root, filepath.FromSlash(key))
+}
+
+func (b *localBackend) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, b.secret)
+	fmt.Fprintf(mac, "%s\n%s", key, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contentTypeOf(key string) string {
+	contentType := mime.TypeByExtension(path.Ext(key))
+
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+
+	return contentType
+}
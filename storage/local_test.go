@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testURLSecret = "local-url-secret-for-tests-only-0123"
+
+func TestLocalBackend(t *testing.T) {
+	root := t.TempDir()
+	backend := NewLocalBackend(root, "https://api.example.com/files/", []byte(testURLSecret))
+
+	err := backend.Put("campaign/cover.png", strings.NewReader("image data"), "image/png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := backend.Get("campaign/cover.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(object.Body)
+	object.Body.Close()
+
+	if string(data) != "image data" || object.ContentType != "image/png" || object.Size != 10 {
+		t.Fatalf("unexpected object %q, %+v", data, object)
+	}
+
+	entries, _ := os.ReadDir(root + "/campaign")
+
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+
+	if got := backend.URL("campaign/a b.png"); got != "https://api.example.com/files/campaign/a%20b.png" {
+		t.Fatalf("unexpected URL %s", got)
+	}
+
+	err = backend.Delete("campaign/cover.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = backend.Get("campaign/cover.png")
+
+	if err != ErrNotFound {
+		t.Fatalf("get after delete: %v", err)
+	}
+
+	err = backend.Delete("campaign/cover.png")
+
+	if err != nil {
+		t.Fatalf("deleting a missing file: %v", err)
+	}
+
+	_, err = backend.Get("campaign")
+
+	if err != ErrNotFound {
+		t.Fatalf("get of a folder: %v", err)
+	}
+}
+
+func TestLocalBackendRejectsInvalidKeys(t *testing.T) {
+	backend := NewLocalBackend(t.TempDir(), "/files", []byte(testURLSecret))
+
+	for _, key := range []string{"", "/etc/passwd", "../escape.png", "campaign/../../escape.png", "campaign//a.png", "campaign/./a.png", "campaign\\a.png", "campaign/a\x00.png", "campaign/a\n.png"} {
+		if err := backend.Put(key, strings.NewReader("data"), "image/png"); err != ErrInvalidKey {
+			t.Errorf("put %q: %v", key, err)
+		}
+
+		if _, err := backend.Get(key); err != ErrInvalidKey {
+			t.Errorf("get %q: %v", key, err)
+		}
+
+		if err := backend.Delete(key); err != ErrInvalidKey {
+			t.Errorf("delete %q: %v", key, err)
+		}
+	}
+}
+
+func TestLocalBackendServeHTTP(t *testing.T) {
+	backend := NewLocalBackend(t.TempDir(), "/files", []byte(testURLSecret))
+
+	err := backend.Put("avatar/a.png", strings.NewReader("image data"), "image/png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/files", backend))
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/files/avatar/a.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK || string(body) != "image data" {
+		t.Fatalf("served %d %q", response.StatusCode, body)
+	}
+
+	if response.Header.Get("Content-Type") != "image/png" || response.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("unexpected headers %v", response.Header)
+	}
+
+	for _, path := range []string{"/files/avatar/missing.png", "/files/avatar", "/files/%2e%2e/secret"} {
+		response, err := http.Get(server.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: served %d", path, response.StatusCode)
+		}
+	}
+
+	response, err = http.Post(server.URL+"/files/avatar/a.png", "image/png", strings.NewReader("other data"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST served %d", response.StatusCode)
+	}
+}
+
+func TestLocalBackendSignedURL(t *testing.T) {
+	backend := NewLocalBackend(t.TempDir(), "/files", []byte(testURLSecret))
+
+	for _, key := range []string{"avatar/a b.png", "avatar/other.png"} {
+		err := backend.Put(key, strings.NewReader("image data"), "image/png")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/files", backend))
+	t.Cleanup(server.Close)
+
+	signed, err := backend.SignedURL("avatar/a b.png", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Get(server.URL + signed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK || string(body) != "image data" {
+		t.Fatalf("served %d %q", response.StatusCode, body)
+	}
+
+	if response.Header.Get("Cache-Control") != "private, no-store" {
+		t.Fatalf("signed file is cacheable: %v", response.Header)
+	}
+
+	expired, err := backend.SignedURL("avatar/a b.png", -time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link, _ := url.Parse(signed)
+	query := link.Query()
+
+	otherKey := *link
+	otherKey.Path = "/files/avatar/other.png"
+
+	query.Set("expires", strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10))
+	extended := *link
+	extended.RawQuery = query.Encode()
+
+	query = link.Query()
+	query.Set("signature", strings.Repeat("0", len(query.Get("signature"))))
+	forged := *link
+	forged.RawQuery = query.Encode()
+
+	otherSecret := NewLocalBackend(t.TempDir(), "/files", []byte("another-url-secret-0123456789abcdef"))
+	foreign, _ := otherSecret.SignedURL("avatar/a b.png", time.Hour)
+
+	for name, target := range map[string]string{
+		"expired":          expired,
+		"another key":      otherKey.String(),
+		"extended expiry":  extended.String(),
+		"forged signature": forged.String(),
+		"another secret":   foreign,
+		"missing expiry":   link.Path + "?signature=" + link.Query().Get("signature"),
+	} {
+		response, err := http.Get(server.URL + target)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: served %d", name, response.StatusCode)
+		}
+	}
+
+	if _, err := backend.SignedURL("../escape.png", time.Hour); err != ErrInvalidKey {
+		t.Fatalf("signed an invalid key: %v", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	if key := Key("images/avatar/a.png"); key != "avatar/a.png" {
+		t.Fatalf("legacy name mapped to %q", key)
+	}
+
+	if key := Key("avatar/a.png"); key != "avatar/a.png" {
+		t.Fatalf("name mapped to %q", key)
+	}
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxPresignTTL   = 7 * 24 * time.Hour
+)
+
+// S3Config points the S3 backend at a bucket. Requests use path-style URLs
+// (endpoint/bucket/key), which AWS and self-hosted stores like MinIO accept.
+// PublicURL is where the bucket is readable without credentials, such as a
+// CDN; it defaults to the bucket's own URL.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PublicURL       string
+}
+
+type s3Backend struct {
+	config S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3Backend(config S3Config) *s3Backend {
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+
+	if config.PublicURL == "" {
+		config.PublicURL = config.Endpoint + "/" + config.Bucket
+	}
+
+	config.PublicURL = strings.TrimRight(config.PublicURL, "/")
+
+	return &s3Backend{config, &http.Client{Timeout: 30 * time.Second}, time.Now}
+}
+
+// Put buffers the body to sign its hash; uploads are small images.
+func (b *s3Backend) Put(key string, body io.Reader, contentType string) error {
+	err := validateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPut, b.objectURL(key), bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := b.do(request, data)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return b.responseError("put", key, response)
+	}
+
+	return nil
+}
+
+func (b *s3Backend) Get(key string) (Object, error) {
+	err := validateKey(key)
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, b.objectURL(key), nil)
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	response, err := b.do(request, nil)
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return Object{}, ErrNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return Object{}, b.responseError("get", key, response)
+	}
+
+	object := Object{}
+	object.Body = response.Body
+	object.ContentType = response.Header.Get("Content-Type")
+	object.Size = response.ContentLength
+	object.LastModified, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return object, nil
+}
+
+// Delete succeeds for missing files, as S3 itself does.
+func (b *s3Backend) Delete(key string) error {
+	err := validateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodDelete, b.objectURL(key), nil)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := b.do(request, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return b.responseError("delete", key, response)
+	}
+
+	return nil
+}
+
+func (b *s3Backend) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return b.config.PublicURL + "/" + escapeKey(key)
+}
+
+// SignedURL returns a presigned GET URL. S3 caps their lifetime at a week.
+func (b *s3Backend) SignedURL(key string, ttl time.Duration) (string, error) {
+	err := validateKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if ttl <= 0 || ttl > maxPresignTTL {
+		return "", fmt.Errorf("signed URL lifetime must be between 1s and %s", maxPresignTTL)
+	}
+
+	target, err := url.Parse(b.objectURL(key))
+
+	if err != nil {
+		return "", err
+	}
+
+	now := b.now().UTC()
+	scope := b.scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", b.config.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	target.RawQuery = canonicalQuery(query)
+
+	headers := http.Header{}
+	headers.Set("Host", target.Host)
+
+	signature := b.signature(http.MethodGet, target, headers, unsignedPayload, now)
+
+	return target.String() + "&X-Amz-Signature=" + signature, nil
+}
+
+func (b *s3Backend) objectURL(key string) string {
+	return b.config.Endpoint + "/" + b.config.Bucket + "/" + awsEscapeKey(key)
+}
+
+// do signs the request with AWS Signature Version 4 and sends it.
+func (b *s3Backend) do(request *http.Request, body []byte) (*http.Response, error) {
+	now := b.now().UTC()
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := signedHeaderNames(request.Header)
+	signature := b.signature(request.Method, request.URL, request.Header, payloadHash, now)
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", b.config.AccessKeyID, b.scope(now), signedHeaders, signature))
+	request.Header.Del("Host")
+
+	return b.client.Do(request)
+}
+
+func (b *s3Backend) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + b.config.Region + "/s3/aws4_request"
+}
+
+func (b *s3Backend) signature(method string, target *url.URL, headers http.Header, payloadHash string, now time.Time) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		target.RawQuery,
+		canonicalHeaders(headers),
+		signedHeaderNames(headers),
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		b.scope(now),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, b.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (b *s3Backend) responseError(operation string, key string, response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+	return fmt.Errorf("storage %s %s: %s: %s", operation, key, response.Status, strings.TrimSpace(string(body)))
+}
+
+func canonicalHeaders(headers http.Header) string {
+	var lines []string
+
+	for name, values := range headers {
+		lines = append(lines, strings.ToLower(name)+":"+strings.TrimSpace(strings.Join(values, ",")))
+	}
+
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func signedHeaderNames(headers http.Header) string {
+	var names []string
+
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ";")
+}
+
+// canonicalQuery encodes the query the way SigV4 expects: sorted, with
+// spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// awsEscapeKey escapes everything but unreserved characters, as the SigV4
+// canonical URI requires; url.PathEscape leaves some of them alone.
+func awsEscapeKey(key string) string {
+	var escaped strings.Builder
+
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+
+	return escaped.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,79 @@
+// Package storage keeps uploaded files. Files are addressed by keys such as
+// "campaign/12-cover.png"; how and where they are stored, and the URLs they
+// are served from, depend on the backend.
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Backend interface {
+	Put(key string, body io.Reader, contentType string) error
+	Get(key string) (Object, error)
+	Delete(key string) error
+	// URL returns the public URL of the file, or "" for an empty key.
+	URL(key string) string
+	// SignedURL returns a URL that grants access to the file until ttl
+	// has passed, for files that are not meant to be public.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Object is a stored file. The caller must close Body.
+type Object struct {
+	Body         io.ReadCloser
+	ContentType  string
+	Size         int64
+	LastModified time.Time
+}
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// legacyPrefix is the folder uploads were saved under, and stored with,
+// before files went through a backend.
+const legacyPrefix = "images/"
+
+// Key returns the storage key of a file name stored on an entity. Names saved
+// before storage backends still carry the old "images/" folder.
+func Key(name string) string {
+	return strings.TrimPrefix(name, legacyPrefix)
+}
+
+// validateKey rejects keys that could escape the storage root or would not
+// survive being put in a URL path.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+
+		for _, r := range segment {
+			if r < 0x20 || r == 0x7f {
+				return ErrInvalidKey
+			}
+		}
+	}
+
+	return nil
+}
+
+// escapeKey escapes each segment of key for use in a URL path.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,59 @@
+package transaction
+
+import (
+	"go_crowdfund/campaign"
+	"go_crowdfund/user"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusPaid     = "paid"
+	StatusExpired  = "expired"
+	StatusFailed   = "failed"
+	StatusRefunded = "refunded"
+)
+
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// Why a refund was queued. A refund for a reward that sold out before the
+// payment arrived gives back money for a pledge that never held its reward.
+const (
+	RefundCampaignClosed = "campaign_closed"
+	RefundRewardSoldOut  = "reward_sold_out"
+)
+
+type Transaction struct {
+	ID           int
+	CampaignID   int
+	UserID       int
+	RewardTierID int
+	Amount       int
+	Status       string
+	Code         string
+	PaymentURL   string
+	User         user.User
+	Campaign     campaign.Campaign
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type Refund struct {
+	ID               int
+	TransactionID    int `gorm:"uniqueIndex"`
+	CampaignID       int
+	UserID           int
+	Amount           int
+	Status           string `gorm:"size:20"`
+	Reason           string `gorm:"size:20"`
+	GatewayReference string
+	Attempts         int
+	LastError        string
+	Transaction      Transaction
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
@@ -0,0 +1,63 @@
+package transaction
+
+import "time"
+
+type TransactionFormatter struct {
+	ID           int       `json:"id"`
+	CampaignID   int       `json:"campaign_id"`
+	UserID       int       `json:"user_id"`
+	RewardTierID int       `json:"reward_tier_id"`
+	Amount       int       `json:"amount"`
+	Status       string    `json:"status"`
+	Code         string    `json:"code"`
+	PaymentURL   string    `json:"payment_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func FormatTransaction(transaction Transaction) TransactionFormatter {
+	formatter := TransactionFormatter{}
+	formatter.ID = transaction.ID
+	formatter.CampaignID = transaction.CampaignID
+	formatter.UserID = transaction.UserID
+	formatter.RewardTierID = transaction.RewardTierID
+	formatter.Amount = transaction.Amount
+	formatter.Status = transaction.Status
+	formatter.Code = transaction.Code
+	formatter.PaymentURL = transaction.PaymentURL
+	formatter.CreatedAt = transaction.CreatedAt
+
+	return formatter
+}
+
+type CampaignTransactionFormatter struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	UserName     string    `json:"user_name"`
+	UserEmail    string    `json:"user_email"`
+	RewardTierID int       `json:"reward_tier_id"`
+	Amount       int       `json:"amount"`
+	Status       string    `json:"status"`
+	Code         string    `json:"code"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func FormatCampaignTransactions(transactions []Transaction) []CampaignTransactionFormatter {
+	transactionsFormatter := []CampaignTransactionFormatter{}
+
+	for _, transaction := range transactions {
+		formatter := CampaignTransactionFormatter{}
+		formatter.ID = transaction.ID
+		formatter.UserID = transaction.UserID
+		formatter.UserName = transaction.User.Name
+		formatter.UserEmail = transaction.User.Email
+		formatter.RewardTierID = transaction.RewardTierID
+		formatter.Amount = transaction.Amount
+		formatter.Status = transaction.Status
+		formatter.Code = transaction.Code
+		formatter.CreatedAt = transaction.CreatedAt
+
+		transactionsFormatter = append(transactionsFormatter, formatter)
+	}
+
+	return transactionsFormatter
+}
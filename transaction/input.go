@@ -0,0 +1,16 @@
+package transaction
+
+import "go_crowdfund/user"
+
+type CreateTransactionInput struct {
+	Amount       int `json:"amount" binding:"required,gt=0"`
+	RewardTierID int `json:"reward_tier_id"`
+	CampaignID   int
+	User         user.User
+}
+
+type GetCampaignTransactionsInput struct {
+	ID     int    `uri:"id" binding:"required"`
+	Limit  int    `form:"limit" binding:"gte=0,lte=100"`
+	Cursor string `form:"cursor"`
+}
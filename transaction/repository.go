@@ -0,0 +1,354 @@
+package transaction
+
+import (
+	"errors"
+	"go_crowdfund/campaign"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	Save(transaction Transaction) (Transaction, error)
+	Update(transaction Transaction) (Transaction, error)
+	GetByID(ID int) (Transaction, error)
+	GetByCode(code string) (Transaction, error)
+	GetByCampaignID(campaignID int, offset int, limit int) ([]Transaction, int64, error)
+	GetPendingBefore(before time.Time, limit int) ([]Transaction, error)
+	MarkAsPaid(transaction Transaction) (bool, error)
+	UpdateStatus(transaction Transaction, to string) (bool, error)
+	QueueRefunds() (int, error)
+	GetPendingRefunds(limit int) ([]Refund, error)
+	UpdateRefund(refund Refund) (Refund, error)
+	MarkAsRefunded(refund Refund) error
+}
+
+var ErrRewardSoldOut = errors.New("reward is sold out")
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *repository {
+	return &repository{db}
+}
+
+// Save claims the pledge's reward tier in the same DB transaction, so a
+// limited tier can never be claimed more often than its quantity limit.
+func (r *repository) Save(transaction Transaction) (Transaction, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if transaction.RewardTierID != 0 {
+			claimed, err := claimRewardTier(tx, transaction.RewardTierID)
+
+			if err != nil {
+				return err
+			}
+
+			if !claimed {
+				return ErrRewardSoldOut
+			}
+		}
+
+		return tx.Create(&transaction).Error
+	})
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+func (r *repository) Update(transaction Transaction) (Transaction, error) {
+	err := r.db.Save(&transaction).Error
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+func (r *repository) GetByID(ID int) (Transaction, error) {
+	var transaction Transaction
+	err := r.db.Where("id = ?", ID).Find(&transaction).Error
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+func (r *repository) GetByCampaignID(campaignID int, offset int, limit int) ([]Transaction, int64, error) {
+	var transactions []Transaction
+	var total int64
+
+	err := r.db.Model(&Transaction{}).Where("campaign_id = ?", campaignID).Count(&total).Error
+
+	if err != nil {
+		return transactions, total, err
+	}
+
+	err = r.db.Preload("User").Where("campaign_id = ?", campaignID).Order("id desc").Offset(offset).Limit(limit).Find(&transactions).Error
+
+	if err != nil {
+		return transactions, total, err
+	}
+
+	return transactions, total, nil
+}
+
+func (r *repository) GetPendingBefore(before time.Time, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	err := r.db.Where("status = ? AND created_at < ?", StatusPending, before).Order("id asc").Limit(limit).Find(&transactions).Error
+
+	if err != nil {
+		return transactions, err
+	}
+
+	return transactions, nil
+}
+
+func (r *repository) GetByCode(code string) (Transaction, error) {
+	var transaction Transaction
+	err := r.db.Where("code = ?", code).Find(&transaction).Error
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+// MarkAsPaid flips the transaction to paid and credits the campaign in the
+// same DB transaction. It reports false when the transaction was already paid
+// or refunded. The money has been taken either way, so a late payment for an
+// expired or failed pledge whose reward has sold out in the meantime is still
+// recorded; instead of crediting the campaign it queues a refund.
+func (r *repository) MarkAsPaid(transaction Transaction) (bool, error) {
+	marked := false
+
+	if transaction.Status != StatusPending && transaction.Status != StatusExpired && transaction.Status != StatusFailed {
+		return false, nil
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Transaction{}).
+			Where("id = ? AND status = ?", transaction.ID, transaction.Status).
+			Update("status", StatusPaid)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if transaction.RewardTierID != 0 && !holdsReward(transaction.Status) {
+			claimed, err := claimRewardTier(tx, transaction.RewardTierID)
+
+			if err != nil {
+				return err
+			}
+
+			if !claimed {
+				err = tx.Create(&Refund{
+					TransactionID: transaction.ID,
+					CampaignID:    transaction.CampaignID,
+					UserID:        transaction.UserID,
+					Amount:        transaction.Amount,
+					Status:        RefundPending,
+					Reason:        RefundRewardSoldOut,
+				}).Error
+
+				if err != nil {
+					return err
+				}
+
+				marked = true
+				return nil
+			}
+		}
+
+		var previousPledges int64
+		err := tx.Model(&Transaction{}).
+			Where("campaign_id = ? AND user_id = ? AND status = ? AND id <> ?", transaction.CampaignID, transaction.UserID, StatusPaid, transaction.ID).
+			Count(&previousPledges).Error
+
+		if err != nil {
+			return err
+		}
+
+		newBackers := 0
+		if previousPledges == 0 {
+			newBackers = 1
+		}
+
+		err = tx.Model(&campaign.Campaign{}).Where("id = ?", transaction.CampaignID).Updates(map[string]interface{}{
+			"current_amount": gorm.Expr("current_amount + ?", transaction.Amount),
+			"backer_count":   gorm.Expr("backer_count + ?", newBackers),
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		marked = true
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return marked, nil
+}
+
+func (r *repository) UpdateStatus(transaction Transaction, to string) (bool, error) {
+	updated := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Transaction{}).Where("id = ? AND status = ?", transaction.ID, transaction.Status).Update("status", to)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if transaction.RewardTierID != 0 && holdsReward(transaction.Status) && !holdsReward(to) {
+			err := releaseRewardTier(tx, transaction.RewardTierID)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		updated = true
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+// QueueRefunds creates a pending refund for every paid pledge on a campaign
+// that failed under all-or-nothing funding, was cancelled or was taken down. Pledges that
+// already have a refund are skipped, so it is safe to run repeatedly.
+func (r *repository) QueueRefunds() (int, error) {
+	var transactions []Transaction
+	err := r.db.Joins("JOIN campaigns ON campaigns.id = transactions.campaign_id").
+		Where("transactions.status = ?", StatusPaid).
+		Where("(campaigns.status = ? AND campaigns.funding_model = ?) OR campaigns.status IN ?", campaign.StatusFailed, campaign.FundingAllOrNothing, []string{campaign.StatusCancelled, campaign.StatusTakenDown}).
+		Where("NOT EXISTS (SELECT 1 FROM refunds WHERE refunds.transaction_id = transactions.id)").
+		Find(&transactions).Error
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	refunds := []Refund{}
+	for _, transaction := range transactions {
+		refunds = append(refunds, Refund{
+			TransactionID: transaction.ID,
+			CampaignID:    transaction.CampaignID,
+			UserID:        transaction.UserID,
+			Amount:        transaction.Amount,
+			Status:        RefundPending,
+			Reason:        RefundCampaignClosed,
+		})
+	}
+
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&refunds)
+
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+func (r *repository) GetPendingRefunds(limit int) ([]Refund, error) {
+	var refunds []Refund
+	err := r.db.Preload("Transaction").Where("status = ?", RefundPending).Order("id asc").Limit(limit).Find(&refunds).Error
+
+	if err != nil {
+		return refunds, err
+	}
+
+	return refunds, nil
+}
+
+func (r *repository) UpdateRefund(refund Refund) (Refund, error) {
+	err := r.db.Omit("Transaction").Save(&refund).Error
+
+	if err != nil {
+		return refund, err
+	}
+
+	return refund, nil
+}
+
+func (r *repository) MarkAsRefunded(refund Refund) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Refund{}).Where("id = ?", refund.ID).Updates(map[string]interface{}{
+			"status":            RefundSucceeded,
+			"gateway_reference": refund.GatewayReference,
+			"attempts":          refund.Attempts,
+			"last_error":        "",
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&Transaction{}).
+			Where("id = ? AND status = ?", refund.TransactionID, StatusPaid).
+			Update("status", StatusRefunded)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// A pledge refunded because its reward sold out never claimed it.
+		if result.RowsAffected > 0 && refund.Transaction.RewardTierID != 0 && refund.Reason != RefundRewardSoldOut {
+			return releaseRewardTier(tx, refund.Transaction.RewardTierID)
+		}
+
+		return nil
+	})
+}
+
+func holdsReward(status string) bool {
+	return status == StatusPending || status == StatusPaid
+}
+
+func claimRewardTier(tx *gorm.DB, ID int) (bool, error) {
+	result := tx.Model(&campaign.RewardTier{}).
+		Where("id = ? AND (quantity_limit = 0 OR claimed_count < quantity_limit)", ID).
+		Update("claimed_count", gorm.Expr("claimed_count + 1"))
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func releaseRewardTier(tx *gorm.DB, ID int) error {
+	return tx.Model(&campaign.RewardTier{}).
+		Where("id = ? AND claimed_count > 0", ID).
+		Update("claimed_count", gorm.Expr("claimed_count - 1")).Error
+}
@@ -0,0 +1,302 @@
+package transaction
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_crowdfund/campaign"
+	"go_crowdfund/helper"
+	"go_crowdfund/payment"
+	"go_crowdfund/policy"
+	"go_crowdfund/user"
+	"time"
+)
+
+type Service interface {
+	CreateTransaction(input CreateTransactionInput) (Transaction, error)
+	ProcessPayment(notification payment.Notification) error
+	ExpirePendingTransactions(now time.Time, limit int) (int, error)
+	QueueRefunds() (int, error)
+	ProcessRefunds(limit int) (int, error)
+	GetCampaignTransactions(input GetCampaignTransactionsInput, currentUser user.User) ([]Transaction, helper.Pagination, error)
+}
+
+const (
+	MaxRefundAttempts = 5
+	DefaultPageSize   = 20
+	// PendingExpiry leaves the gateway an hour past the payment page's own
+	// expiry to deliver its last notification.
+	PendingExpiry = payment.PaymentExpiry + time.Hour
+)
+
+type service struct {
+	repository         Repository
+	campaignRepository campaign.Repository
+	paymentGateway     payment.Gateway
+}
+
+func NewService(repository Repository, campaignRepository campaign.Repository, paymentGateway payment.Gateway) *service {
+	return &service{repository, campaignRepository, paymentGateway}
+}
+
+func (s *service) CreateTransaction(input CreateTransactionInput) (Transaction, error) {
+	err := policy.Authorize(input.User, policy.PledgeCreate)
+
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	backedCampaign, err := s.campaignRepository.FindByID(input.CampaignID)
+
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if backedCampaign.ID == 0 {
+		return Transaction{}, campaign.ErrNotFound
+	}
+
+	if !backedCampaign.AcceptsPledges(time.Now()) {
+		return Transaction{}, errors.New("campaign is not accepting pledges")
+	}
+
+	if backedCampaign.UserID == input.User.ID {
+		return Transaction{}, errors.New("cannot back your own campaign")
+	}
+
+	if input.RewardTierID != 0 {
+		err = checkRewardTier(backedCampaign, input)
+
+		if err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	code, err := generateCode(backedCampaign.ID)
+
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{}
+	transaction.CampaignID = backedCampaign.ID
+	transaction.UserID = input.User.ID
+	transaction.RewardTierID = input.RewardTierID
+	transaction.Amount = input.Amount
+	transaction.Status = StatusPending
+	transaction.Code = code
+
+	newTransaction, err := s.repository.Save(transaction)
+
+	if err != nil {
+		return newTransaction, err
+	}
+
+	paymentTransaction := payment.Transaction{
+		ID:     newTransaction.ID,
+		Code:   newTransaction.Code,
+		Amount: newTransaction.Amount,
+	}
+
+	paymentURL, err := s.paymentGateway.GetPaymentURL(paymentTransaction, input.User)
+
+	if err != nil {
+		return newTransaction, err
+	}
+
+	newTransaction.PaymentURL = paymentURL
+
+	newTransaction, err = s.repository.Update(newTransaction)
+
+	if err != nil {
+		return newTransaction, err
+	}
+
+	return newTransaction, nil
+}
+
+// ProcessPayment applies a gateway notification. Callbacks may be delivered
+// more than once, so every transition is conditional on the current status
+// and a paid transaction is only ever credited to its campaign once.
+func (s *service) ProcessPayment(notification payment.Notification) error {
+	transaction, err := s.repository.GetByCode(notification.OrderID)
+
+	if err != nil {
+		return err
+	}
+
+	if transaction.ID == 0 {
+		return errors.New("No transaction found with that code")
+	}
+
+	if notification.GrossAmount != transaction.Amount {
+		return errors.New("payment amount does not match the transaction")
+	}
+
+	switch notification.Status {
+	case payment.StatusPaid:
+		_, err = s.repository.MarkAsPaid(transaction)
+	case payment.StatusExpired, payment.StatusFailed:
+		if transaction.Status == StatusPending {
+			_, err = s.repository.UpdateStatus(transaction, notification.Status)
+		}
+	case payment.StatusPending:
+	default:
+		err = fmt.Errorf("unknown payment status %q", notification.Status)
+	}
+
+	return err
+}
+
+// ExpirePendingTransactions expires pledges that were never paid, releasing
+// the reward tiers they claimed so abandoned checkouts cannot sell out a
+// limited reward.
+func (s *service) ExpirePendingTransactions(now time.Time, limit int) (int, error) {
+	transactions, err := s.repository.GetPendingBefore(now.Add(-PendingExpiry), limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+
+	for _, transaction := range transactions {
+		updated, err := s.repository.UpdateStatus(transaction, StatusExpired)
+
+		if err != nil {
+			return expired, err
+		}
+
+		if updated {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+func (s *service) QueueRefunds() (int, error) {
+	return s.repository.QueueRefunds()
+}
+
+// ProcessRefunds sends pending refunds to the payment gateway. Refunds stay
+// pending until the gateway confirms them, so an interrupted batch picks up
+// where it stopped on the next run.
+func (s *service) ProcessRefunds(limit int) (int, error) {
+	refunds, err := s.repository.GetPendingRefunds(limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+
+	for _, refund := range refunds {
+		refund.Attempts++
+
+		reference, err := s.paymentGateway.Refund(payment.Refund{
+			ID:              refund.ID,
+			TransactionCode: refund.Transaction.Code,
+			Amount:          refund.Amount,
+		})
+
+		if err != nil {
+			refund.LastError = err.Error()
+
+			if refund.Attempts >= MaxRefundAttempts {
+				refund.Status = RefundFailed
+			}
+
+			_, err = s.repository.UpdateRefund(refund)
+
+			if err != nil {
+				return processed, err
+			}
+
+			continue
+		}
+
+		refund.GatewayReference = reference
+
+		err = s.repository.MarkAsRefunded(refund)
+
+		if err != nil {
+			return processed, err
+		}
+
+		processed++
+	}
+
+	return processed, nil
+}
+
+func (s *service) GetCampaignTransactions(input GetCampaignTransactionsInput, currentUser user.User) ([]Transaction, helper.Pagination, error) {
+	backedCampaign, err := s.campaignRepository.FindByID(input.ID)
+
+	if err != nil {
+		return []Transaction{}, helper.Pagination{}, err
+	}
+
+	if backedCampaign.ID == 0 {
+		return []Transaction{}, helper.Pagination{}, campaign.ErrNotFound
+	}
+
+	err = policy.AuthorizeOwned(currentUser, policy.TransactionView, backedCampaign.UserID)
+
+	if err != nil {
+		return []Transaction{}, helper.Pagination{}, err
+	}
+
+	offset, err := helper.DecodeCursor(input.Cursor)
+
+	if err != nil {
+		return []Transaction{}, helper.Pagination{}, err
+	}
+
+	limit := input.Limit
+
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+
+	transactions, total, err := s.repository.GetByCampaignID(backedCampaign.ID, offset, limit)
+
+	if err != nil {
+		return transactions, helper.Pagination{}, err
+	}
+
+	return transactions, helper.NewPagination(total, offset, limit), nil
+}
+
+func checkRewardTier(backedCampaign campaign.Campaign, input CreateTransactionInput) error {
+	for _, rewardTier := range backedCampaign.RewardTiers {
+		if rewardTier.ID != input.RewardTierID {
+			continue
+		}
+
+		if input.Amount < rewardTier.MinimumAmount {
+			return fmt.Errorf("this reward needs a pledge of at least %d", rewardTier.MinimumAmount)
+		}
+
+		if rewardTier.IsSoldOut() {
+			return ErrRewardSoldOut
+		}
+
+		return nil
+	}
+
+	return errors.New("No reward found with that ID")
+}
+
+func generateCode(campaignID int) (string, error) {
+	random := make([]byte, 6)
+
+	_, err := rand.Read(random)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("TRX-%d-%s", campaignID, hex.EncodeToString(random)), nil
+}
@@ -0,0 +1,450 @@
+package transaction
+
+import (
+	"encoding/json"
+	"go_crowdfund/campaign"
+	"go_crowdfund/payment"
+	"go_crowdfund/user"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryRepository keeps transactions, refunds and reward tier claims the way
+// the database repository does, without a database.
+type memoryRepository struct {
+	Repository
+	transactions map[int]Transaction
+	refunds      map[int]Refund
+	tiers        map[int]*campaign.RewardTier
+	credited     map[int]int
+}
+
+func newMemoryRepository(tiers ...*campaign.RewardTier) *memoryRepository {
+	repository := &memoryRepository{
+		transactions: map[int]Transaction{},
+		refunds:      map[int]Refund{},
+		tiers:        map[int]*campaign.RewardTier{},
+		credited:     map[int]int{},
+	}
+
+	for _, tier := range tiers {
+		repository.tiers[tier.ID] = tier
+	}
+
+	return repository
+}
+
+func (r *memoryRepository) claim(ID int) bool {
+	tier := r.tiers[ID]
+
+	if tier.IsSoldOut() {
+		return false
+	}
+
+	tier.ClaimedCount++
+	return true
+}
+
+func (r *memoryRepository) Save(transaction Transaction) (Transaction, error) {
+	if transaction.RewardTierID != 0 && !r.claim(transaction.RewardTierID) {
+		return transaction, ErrRewardSoldOut
+	}
+
+	transaction.ID = len(r.transactions) + 1
+	transaction.CreatedAt = time.Now()
+	r.transactions[transaction.ID] = transaction
+
+	return transaction, nil
+}
+
+func (r *memoryRepository) Update(transaction Transaction) (Transaction, error) {
+	r.transactions[transaction.ID] = transaction
+	return transaction, nil
+}
+
+func (r *memoryRepository) GetByCode(code string) (Transaction, error) {
+	for _, transaction := range r.transactions {
+		if transaction.Code == code {
+			return transaction, nil
+		}
+	}
+
+	return Transaction{}, nil
+}
+
+func (r *memoryRepository) GetPendingBefore(before time.Time, limit int) ([]Transaction, error) {
+	transactions := []Transaction{}
+
+	for _, transaction := range r.transactions {
+		if transaction.Status == StatusPending && transaction.CreatedAt.Before(before) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions, nil
+}
+
+func (r *memoryRepository) MarkAsPaid(transaction Transaction) (bool, error) {
+	current := r.transactions[transaction.ID]
+
+	if current.Status != transaction.Status || (current.Status != StatusPending && current.Status != StatusExpired && current.Status != StatusFailed) {
+		return false, nil
+	}
+
+	soldOut := current.RewardTierID != 0 && !holdsReward(current.Status) && !r.claim(current.RewardTierID)
+
+	current.Status = StatusPaid
+	r.transactions[current.ID] = current
+
+	if soldOut {
+		ID := len(r.refunds) + 1
+		r.refunds[ID] = Refund{ID: ID, TransactionID: current.ID, CampaignID: current.CampaignID, UserID: current.UserID, Amount: current.Amount, Status: RefundPending, Reason: RefundRewardSoldOut}
+
+		return true, nil
+	}
+
+	r.credited[current.CampaignID] += current.Amount
+
+	return true, nil
+}
+
+func (r *memoryRepository) UpdateStatus(transaction Transaction, to string) (bool, error) {
+	current := r.transactions[transaction.ID]
+
+	if current.Status != transaction.Status {
+		return false, nil
+	}
+
+	if current.RewardTierID != 0 && holdsReward(current.Status) && !holdsReward(to) {
+		r.tiers[current.RewardTierID].ClaimedCount--
+	}
+
+	current.Status = to
+	r.transactions[current.ID] = current
+
+	return true, nil
+}
+
+func (r *memoryRepository) GetPendingRefunds(limit int) ([]Refund, error) {
+	refunds := []Refund{}
+
+	for _, refund := range r.refunds {
+		if refund.Status == RefundPending {
+			refund.Transaction = r.transactions[refund.TransactionID]
+			refunds = append(refunds, refund)
+		}
+	}
+
+	return refunds, nil
+}
+
+func (r *memoryRepository) UpdateRefund(refund Refund) (Refund, error) {
+	r.refunds[refund.ID] = refund
+	return refund, nil
+}
+
+func (r *memoryRepository) MarkAsRefunded(refund Refund) error {
+	refund.Status = RefundSucceeded
+	r.refunds[refund.ID] = refund
+
+	transaction := r.transactions[refund.TransactionID]
+
+	if transaction.Status == StatusPaid && transaction.RewardTierID != 0 && refund.Reason != RefundRewardSoldOut {
+		r.tiers[transaction.RewardTierID].ClaimedCount--
+	}
+
+	transaction.Status = StatusRefunded
+	r.transactions[transaction.ID] = transaction
+
+	return nil
+}
+
+type memoryCampaignRepository struct {
+	campaign.Repository
+	campaign campaign.Campaign
+}
+
+func (r *memoryCampaignRepository) FindByID(ID int) (campaign.Campaign, error) {
+	if ID != r.campaign.ID {
+		return campaign.Campaign{}, nil
+	}
+
+	return r.campaign, nil
+}
+
+type paymentSetup struct {
+	repository *memoryRepository
+	gateway    payment.Sandbox
+	service    *service
+	tier       *campaign.RewardTier
+}
+
+// newPaymentSetup serves the sandbox's notification webhook the way the
+// transaction handler does, so Simulate goes through a signed callback.
+func newPaymentSetup(t *testing.T) paymentSetup {
+	tier := &campaign.RewardTier{ID: 7, CampaignID: 1, MinimumAmount: 50000, QuantityLimit: 1}
+	now := time.Now()
+
+	campaignRepository := &memoryCampaignRepository{campaign: campaign.Campaign{
+		ID:          1,
+		UserID:      99,
+		Status:      campaign.StatusLive,
+		StartsAt:    now.Add(-time.Hour),
+		EndsAt:      now.Add(time.Hour),
+		RewardTiers: []campaign.RewardTier{*tier},
+	}}
+
+	repository := newMemoryRepository(tier)
+
+	var setup paymentSetup
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/transactions/notification" {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		notification, err := setup.gateway.ParseNotification(r.Header, body)
+
+		if err == nil {
+			err = setup.service.ProcessPayment(notification)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	gateway := payment.NewSandboxGateway([]byte("sandbox-test-secret"), server.URL)
+	setup = paymentSetup{repository, gateway, NewService(repository, campaignRepository, gateway), tier}
+
+	return setup
+}
+
+func backer(ID int) user.User {
+	verifiedAt := time.Now()
+	return user.User{ID: ID, Email: "backer@example.com", Role: user.RoleUser, EmailVerifiedAt: &verifiedAt}
+}
+
+func paymentToken(t *testing.T, transaction Transaction) string {
+	index := strings.Index(transaction.PaymentURL, "/sandbox/payments/")
+
+	if index < 0 {
+		t.Fatalf("unexpected payment URL %q", transaction.PaymentURL)
+	}
+
+	return transaction.PaymentURL[index+len("/sandbox/payments/"):]
+}
+
+func TestSandboxPaymentFlow(t *testing.T) {
+	setup := newPaymentSetup(t)
+
+	pledge, err := setup.service.CreateTransaction(CreateTransactionInput{Amount: 75000, RewardTierID: setup.tier.ID, CampaignID: 1, User: backer(2)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pledge.Status != StatusPending || setup.tier.ClaimedCount != 1 {
+		t.Fatalf("pledge %+v, tier claimed %d times", pledge, setup.tier.ClaimedCount)
+	}
+
+	token := paymentToken(t, pledge)
+	issued, ok := setup.gateway.GetPayment(token)
+
+	if !ok || issued.Code != pledge.Code || issued.Amount != pledge.Amount {
+		t.Fatalf("payment token resolves to %+v, %v", issued, ok)
+	}
+
+	err = setup.gateway.Simulate(token, payment.StatusPaid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gateways deliver callbacks more than once; the campaign is credited
+	// once.
+	err = setup.gateway.Simulate(token, payment.StatusPaid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setup.gateway.Simulate(token, payment.StatusExpired)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paid := setup.repository.transactions[pledge.ID]
+
+	if paid.Status != StatusPaid || setup.repository.credited[1] != 75000 || setup.tier.ClaimedCount != 1 {
+		t.Fatalf("pledge %s, campaign credited %d, tier claimed %d times", paid.Status, setup.repository.credited[1], setup.tier.ClaimedCount)
+	}
+
+	_, err = setup.service.CreateTransaction(CreateTransactionInput{Amount: 75000, RewardTierID: setup.tier.ID, CampaignID: 1, User: backer(3)})
+
+	if err != ErrRewardSoldOut {
+		t.Fatalf("expected the reward to be sold out, got %v", err)
+	}
+}
+
+func TestSandboxRejectsTamperedPayments(t *testing.T) {
+	setup := newPaymentSetup(t)
+
+	pledge, err := setup.service.CreateTransaction(CreateTransactionInput{Amount: 10000, CampaignID: 1, User: backer(2)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := paymentToken(t, pledge)
+	parts := strings.Split(token, ".")
+	cheaper := parts[0] + ".1." + parts[2]
+
+	if _, ok := setup.gateway.GetPayment(cheaper); ok {
+		t.Fatal("a token with a changed amount was accepted")
+	}
+
+	if err := setup.gateway.Simulate(cheaper, payment.StatusPaid); err == nil {
+		t.Fatal("settled a payment with a changed amount")
+	}
+
+	body, err := json.Marshal(payment.Notification{OrderID: pledge.Code, Status: payment.StatusPaid, GrossAmount: pledge.Amount})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set(payment.SandboxSignatureHeader, strings.Repeat("0", 64))
+
+	if _, err := setup.gateway.ParseNotification(header, body); err == nil {
+		t.Fatal("accepted a notification with a bad signature")
+	}
+
+	err = setup.service.ProcessPayment(payment.Notification{OrderID: pledge.Code, Status: payment.StatusPaid, GrossAmount: 1})
+
+	if err == nil {
+		t.Fatal("accepted a payment for the wrong amount")
+	}
+
+	if status := setup.repository.transactions[pledge.ID].Status; status != StatusPending {
+		t.Fatalf("tampered payments left the pledge %s", status)
+	}
+}
+
+func TestExpirePendingTransactionsReleasesReward(t *testing.T) {
+	setup := newPaymentSetup(t)
+
+	pledge, err := setup.service.CreateTransaction(CreateTransactionInput{Amount: 50000, RewardTierID: setup.tier.ID, CampaignID: 1, User: backer(2)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := setup.service.ExpirePendingTransactions(time.Now(), 10)
+
+	if err != nil || expired != 0 {
+		t.Fatalf("expired %d fresh pledges, err %v", expired, err)
+	}
+
+	expired, err = setup.service.ExpirePendingTransactions(time.Now().Add(PendingExpiry+time.Minute), 10)
+
+	if err != nil || expired != 1 {
+		t.Fatalf("expired %d stale pledges, err %v", expired, err)
+	}
+
+	if setup.repository.transactions[pledge.ID].Status != StatusExpired || setup.tier.ClaimedCount != 0 {
+		t.Fatalf("pledge %s, tier claimed %d times", setup.repository.transactions[pledge.ID].Status, setup.tier.ClaimedCount)
+	}
+
+	// The released slot goes to someone else. The late payment for the
+	// expired pledge is still recorded, but refunded rather than credited
+	// so the reward is not oversold.
+	_, err = setup.service.CreateTransaction(CreateTransactionInput{Amount: 50000, RewardTierID: setup.tier.ID, CampaignID: 1, User: backer(3)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setup.gateway.Simulate(paymentToken(t, pledge), payment.StatusPaid)
+
+	if err != nil {
+		t.Fatalf("the late payment notification was rejected: %v", err)
+	}
+
+	if setup.repository.transactions[pledge.ID].Status != StatusPaid || setup.repository.credited[1] != 0 || setup.tier.ClaimedCount != 1 {
+		t.Fatalf("pledge %s, campaign credited %d, tier claimed %d times", setup.repository.transactions[pledge.ID].Status, setup.repository.credited[1], setup.tier.ClaimedCount)
+	}
+
+	refunds, _ := setup.repository.GetPendingRefunds(10)
+
+	if len(refunds) != 1 || refunds[0].TransactionID != pledge.ID || refunds[0].Amount != pledge.Amount || refunds[0].Reason != RefundRewardSoldOut {
+		t.Fatalf("unexpected refunds %+v", refunds)
+	}
+
+	// A redelivered notification neither pays nor refunds twice.
+	err = setup.service.ProcessPayment(payment.Notification{OrderID: pledge.Code, Status: payment.StatusPaid, GrossAmount: pledge.Amount})
+
+	if err != nil || len(setup.repository.refunds) != 1 {
+		t.Fatalf("%d refunds, err %v", len(setup.repository.refunds), err)
+	}
+
+	refunded, err := setup.service.ProcessRefunds(10)
+
+	if err != nil || refunded != 1 {
+		t.Fatalf("refunded %d, err %v", refunded, err)
+	}
+
+	// The refunded pledge never held the reward, so the other backer keeps it.
+	if setup.repository.transactions[pledge.ID].Status != StatusRefunded || setup.tier.ClaimedCount != 1 {
+		t.Fatalf("pledge %s, tier claimed %d times", setup.repository.transactions[pledge.ID].Status, setup.tier.ClaimedCount)
+	}
+}
+
+func TestProcessRefundsThroughSandbox(t *testing.T) {
+	setup := newPaymentSetup(t)
+
+	pledge, err := setup.service.CreateTransaction(CreateTransactionInput{Amount: 10000, CampaignID: 1, User: backer(2)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setup.gateway.Simulate(paymentToken(t, pledge), payment.StatusPaid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setup.repository.refunds[1] = Refund{ID: 1, TransactionID: pledge.ID, CampaignID: 1, UserID: 2, Amount: 10000, Status: RefundPending}
+	setup.repository.refunds[2] = Refund{ID: 2, TransactionID: pledge.ID, CampaignID: 1, UserID: 2, Amount: 0, Status: RefundPending, Attempts: MaxRefundAttempts - 1}
+
+	refunded, err := setup.service.ProcessRefunds(10)
+
+	if err != nil || refunded != 1 {
+		t.Fatalf("refunded %d, err %v", refunded, err)
+	}
+
+	succeeded := setup.repository.refunds[1]
+
+	if succeeded.Status != RefundSucceeded || succeeded.GatewayReference != "REFUND-"+pledge.Code+"-1" || succeeded.Attempts != 1 {
+		t.Fatalf("unexpected refund %+v", succeeded)
+	}
+
+	if setup.repository.transactions[pledge.ID].Status != StatusRefunded {
+		t.Fatalf("refunded pledge is %s", setup.repository.transactions[pledge.ID].Status)
+	}
+
+	failed := setup.repository.refunds[2]
+
+	if failed.Status != RefundFailed || failed.LastError == "" {
+		t.Fatalf("a refund the gateway keeps rejecting ended up %+v", failed)
+	}
+}
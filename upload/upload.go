@@ -0,0 +1,276 @@
+// Package upload validates uploaded images and stores them under names the
+// uploader does not control.
+package upload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go_crowdfund/storage"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultMaxPixels bounds the decoded size of an image. A few kilobytes
+	// of compressed data can claim to be a huge image, and decoding it would
+	// take width*height*4 bytes of memory.
+	DefaultMaxPixels = 25000000
+
+	// MaxDimension bounds each side of an image.
+	MaxDimension = 10000
+
+	// formOverhead is the room left in an upload request for the multipart
+	// framing and the form's other fields.
+	formOverhead = 64 << 10
+)
+
+// allowedTypes maps the content types accepted, as sniffed from the data, to
+// the image.DecodeConfig format and the extension files are stored with.
+var allowedTypes = map[string]struct {
+	format    string
+	extension string
+}{
+	"image/jpeg": {"jpeg", ".jpg"},
+	"image/png":  {"png", ".png"},
+	"image/gif":  {"gif", ".gif"},
+}
+
+// Kind describes one sort of upload, such as avatars.
+type Kind struct {
+	Name      string
+	Folder    string
+	MaxSize   int64
+	MaxPixels int
+	Variants  []Variant
+}
+
+// MaxRequestSize is the largest request body a file of the kind can be
+// uploaded in.
+func (k Kind) MaxRequestSize() int64 {
+	return k.MaxSize + formOverhead
+}
+
+// Image is a validated upload.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// ValidationError is returned for files that are rejected, with a message
+// meant for the user.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// Stored is a saved upload: the key of the original and the names of the
+// variants stored next to it. See VariantKey.
+type Stored struct {
+	Key      string
+	Variants []string
+}
+
+type Pipeline struct {
+	files storage.Backend
+}
+
+func NewPipeline(files storage.Backend) *Pipeline {
+	return &Pipeline{files}
+}
+
+// Save validates file as an upload of kind and stores it under a random
+// name in the kind's folder, along with the kind's variants. The original is
+// re-encoded too, except for GIFs, so no metadata is kept.
+func (p *Pipeline) Save(kind Kind, file *multipart.FileHeader) (Stored, error) {
+	img, err := Validate(kind, file)
+
+	if err != nil {
+		return Stored{}, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+
+	if err != nil {
+		return Stored{}, ValidationError{fmt.Sprintf("The %s could not be decoded", kind.Name)}
+	}
+
+	if img.ContentType == "image/jpeg" {
+		decoded = orient(decoded, jpegOrientation(img.Data))
+	}
+
+	name, err := randomName()
+
+	if err != nil {
+		return Stored{}, err
+	}
+
+	stored := Stored{}
+	stored.Key = kind.Folder + "/" + name + img.Extension
+
+	// GIFs may be animated, and re-encoding would keep only the first
+	// frame. The format has no EXIF to strip.
+	data, contentType := img.Data, img.ContentType
+
+	if img.ContentType != "image/gif" {
+		data, contentType, err = encode(decoded, img.ContentType, originalQuality)
+
+		if err != nil {
+			return Stored{}, err
+		}
+	}
+
+	err = p.files.Put(stored.Key, bytes.NewReader(data), contentType)
+
+	if err != nil {
+		return Stored{}, err
+	}
+
+	for _, variant := range kind.Variants {
+		data, contentType, err := encode(resize(decoded, variant), img.ContentType, variantQuality)
+
+		if err == nil {
+			err = p.files.Put(VariantKey(stored.Key, variant.Name), bytes.NewReader(data), contentType)
+		}
+
+		if err != nil {
+			p.Delete(stored.Key, stored.Variants)
+			return Stored{}, err
+		}
+
+		stored.Variants = append(stored.Variants, variant.Name)
+	}
+
+	return stored, nil
+}
+
+// Delete removes a stored upload and its variants. It carries on past
+// failures and returns the first one.
+func (p *Pipeline) Delete(key string, variants []string) error {
+	if key == "" {
+		return nil
+	}
+
+	var firstErr error
+
+	for _, name := range variants {
+		err := p.files.Delete(VariantKey(key, name))
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	err := p.files.Delete(key)
+
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// Validate reads file and checks it against kind. The type is taken from the
+// file's content, never from its name or the client's Content-Type.
+func Validate(kind Kind, file *multipart.FileHeader) (Image, error) {
+	if file.Size > kind.MaxSize {
+		return Image{}, TooLarge(kind)
+	}
+
+	src, err := file.Open()
+
+	if err != nil {
+		return Image{}, err
+	}
+
+	defer src.Close()
+
+	// Read one byte past the limit so files that lie about their size are
+	// caught too.
+	data, err := io.ReadAll(io.LimitReader(src, kind.MaxSize+1))
+
+	if err != nil {
+		return Image{}, err
+	}
+
+	if int64(len(data)) > kind.MaxSize {
+		return Image{}, TooLarge(kind)
+	}
+
+	if len(data) == 0 {
+		return Image{}, ValidationError{fmt.Sprintf("The %s file is empty", kind.Name)}
+	}
+
+	contentType := http.DetectContentType(data)
+	allowed, ok := allowedTypes[contentType]
+
+	if !ok {
+		return Image{}, ValidationError{fmt.Sprintf("The %s must be a JPEG, PNG or GIF image, not %s", kind.Name, strings.SplitN(contentType, ";", 2)[0])}
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || format != allowed.format {
+		return Image{}, ValidationError{fmt.Sprintf("The %s is not a valid %s image", kind.Name, strings.ToUpper(allowed.format))}
+	}
+
+	maxPixels := kind.MaxPixels
+
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > maxPixels {
+		return Image{}, ValidationError{fmt.Sprintf("The %s is %dx%d pixels; images may be at most %d pixels on each side and %d megapixels in total", kind.Name, config.Width, config.Height, MaxDimension, maxPixels/1000000)}
+	}
+
+	img := Image{}
+	img.Data = data
+	img.ContentType = contentType
+	img.Extension = allowed.extension
+	img.Width = config.Width
+	img.Height = config.Height
+
+	return img, nil
+}
+
+// TooLarge is the error for a file over the kind's MaxSize.
+func TooLarge(kind Kind) error {
+	return ValidationError{fmt.Sprintf("The %s must not be larger than %s", kind.Name, formatSize(kind.MaxSize))}
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", size>>10)
+	}
+
+	return fmt.Sprintf("%d bytes", size)
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
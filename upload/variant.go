@@ -0,0 +1,167 @@
+package upload
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+)
+
+// Variant is a resized copy made of every upload of a kind. With Crop the
+// image is cut to exactly Width x Height; otherwise it is scaled to fit
+// inside it. Images are never scaled up.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+// JPEG qualities used when re-encoding. Originals keep more detail since
+// they are what variants will be made from should the sizes change.
+const (
+	originalQuality = 92
+	variantQuality  = 82
+)
+
+// VariantKey returns the key the named variant of an upload is stored
+// under, next to the original: "campaign/3f2a.jpg" has its thumbnail at
+// "campaign/3f2a_thumb.jpg". Variants of anything but JPEGs are PNGs.
+func VariantKey(key string, name string) string {
+	extension := path.Ext(key)
+	variantExtension := ".png"
+
+	if extension == ".jpg" {
+		variantExtension = ".jpg"
+	}
+
+	return strings.TrimSuffix(key, extension) + "_" + name + variantExtension
+}
+
+// encode writes img as JPEG when the upload was a JPEG and as PNG otherwise,
+// so transparency survives. Re-encoding drops all metadata, EXIF included.
+func encode(img image.Image, contentType string, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		return buf.Bytes(), "image/jpeg", err
+	}
+
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", err
+}
+
+// resize returns src scaled, and with Crop cut around its centre, to the
+// variant's size.
+func resize(src image.Image, variant Variant) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	if variant.Crop {
+		// Cut the largest centred area with the variant's aspect ratio.
+		cropWidth, cropHeight := srcWidth, srcWidth*variant.Height/variant.Width
+
+		if cropHeight > srcHeight {
+			cropWidth, cropHeight = srcHeight*variant.Width/variant.Height, srcHeight
+		}
+
+		x := bounds.Min.X + (srcWidth-cropWidth)/2
+		y := bounds.Min.Y + (srcHeight-cropHeight)/2
+		bounds = image.Rect(x, y, x+cropWidth, y+cropHeight)
+		srcWidth, srcHeight = cropWidth, cropHeight
+	}
+
+	width, height := variant.Width, variant.Height
+
+	if !variant.Crop {
+		// Fit inside the box, keeping the aspect ratio.
+		if srcWidth*height > srcHeight*width {
+			height = srcHeight * width / srcWidth
+		} else {
+			width = srcWidth * height / srcHeight
+		}
+	}
+
+	if width >= srcWidth || height >= srcHeight {
+		width, height = srcWidth, srcHeight
+	}
+
+	if width < 1 {
+		width = 1
+	}
+
+	if height < 1 {
+		height = 1
+	}
+
+	return boxScale(toRGBA(src, bounds), width, height)
+}
+
+func toRGBA(src image.Image, bounds image.Rectangle) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && bounds == rgba.Bounds() && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+
+	return dst
+}
+
+// boxScale shrinks src by averaging the block of source pixels each
+// destination pixel covers. It works on premultiplied colours, so transparent
+// pixels do not bleed into their neighbours.
+func boxScale(src *image.RGBA, width int, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	if width == srcWidth && height == srcHeight {
+		copy(dst.Pix, src.Pix)
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				offset := sy*src.Stride + x0*4
+
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[offset])
+					g += uint64(src.Pix[offset+1])
+					b += uint64(src.Pix[offset+2])
+					a += uint64(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -1,6 +1,18 @@
 package user
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+const (
+	RoleUser      = "user"
+	RoleCreator   = "creator"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var Roles = []string{RoleUser, RoleCreator, RoleModerator, RoleAdmin}
 
 type User struct {
 	ID             int
@@ -9,9 +21,98 @@ type User struct {
 	Email          string
 	PasswordHash   string
 	AvatarFileName string
-	Role           string
-	Created_at     time.Time
-	Updated_at     time.Time
+	// AvatarVariants lists, comma-separated, the resized copies stored next
+	// to the avatar.
+	AvatarVariants    string
+	Role              string
+	EmailVerifiedAt   *time.Time
+	PasswordChangedAt *time.Time
+	SuspendedAt       *time.Time
+	SuspensionReason  string
+	// TOTPSecret is sealed with the two-factor encryption key. It is set on
+	// enrollment; two-factor login is only on once TwoFactorEnabledAt is set.
+	TOTPSecret         string
+	TOTPLastCounter    int64
+	TwoFactorEnabledAt *time.Time
+	Created_at         time.Time
+	Updated_at         time.Time
+}
+
+// PasswordResetToken is stored hashed and can be used once before it expires.
+type PasswordResetToken struct {
+	ID        int
+	UserID    int    `gorm:"index"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RecoveryCode is a single-use, stored hashed, fallback for the
+// authenticator app.
+type RecoveryCode struct {
+	ID        int
+	UserID    int    `gorm:"index"`
+	CodeHash  string `gorm:"size:64;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// Roles returns the set of roles stored comma-separated in Role.
+func (u User) Roles() []string {
+	var roles []string
+
+	for _, role := range strings.Split(u.Role, ",") {
+		role = strings.TrimSpace(role)
+
+		if role != "" {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+// AvatarVariantNames returns the set of variants stored comma-separated in
+// AvatarVariants.
+func (u User) AvatarVariantNames() []string {
+	var names []string
+
+	for _, name := range strings.Split(u.AvatarVariants, ",") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (u User) IsVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// HasPassword is false for users who signed up through an external provider
+// and never set one.
+func (u User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+func (u User) HasTwoFactor() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles() {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
 }
 
 // func GetUser()
@@ -1,20 +1,132 @@
 package user
 
+import "time"
+
 type UserFormatter struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Occupation string `json:"occupation"`
-	Email      string `json:"email"`
-	Token      string `json:"token"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Occupation    string `json:"occupation"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	TwoFactor     bool   `json:"two_factor_enabled"`
+	Token         string `json:"token"`
+	RefreshToken  string `json:"refresh_token"`
 }
 
-func FormatUser(user User, token string) UserFormatter {
+func FormatUser(user User, token string, refreshToken string) UserFormatter {
 	formatter := UserFormatter{
-		ID:         user.ID,
-		Name:       user.Name,
-		Occupation: user.Occupation,
-		Email:      user.Email,
-		Token:      token,
+		ID:            user.ID,
+		Name:          user.Name,
+		Occupation:    user.Occupation,
+		Email:         user.Email,
+		EmailVerified: user.IsVerified(),
+		TwoFactor:     user.HasTwoFactor(),
+		Token:         token,
+		RefreshToken:  refreshToken,
+	}
+
+	return formatter
+}
+
+type RolesFormatter struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+func FormatRoles(user User) RolesFormatter {
+	formatter := RolesFormatter{
+		ID:    user.ID,
+		Name:  user.Name,
+		Roles: user.Roles(),
+	}
+
+	if formatter.Roles == nil {
+		formatter.Roles = []string{}
+	}
+
+	return formatter
+}
+
+type AdminUserFormatter struct {
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	Occupation       string     `json:"occupation"`
+	Email            string     `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactor        bool       `json:"two_factor_enabled"`
+	Roles            []string   `json:"roles"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspensionReason string     `json:"suspension_reason"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func FormatAdminUser(user User) AdminUserFormatter {
+	formatter := AdminUserFormatter{
+		ID:               user.ID,
+		Name:             user.Name,
+		Occupation:       user.Occupation,
+		Email:            user.Email,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+		TwoFactor:        user.HasTwoFactor(),
+		Roles:            FormatRoles(user).Roles,
+		SuspendedAt:      user.SuspendedAt,
+		SuspensionReason: user.SuspensionReason,
+		CreatedAt:        user.Created_at,
+	}
+
+	return formatter
+}
+
+func FormatAdminUsers(users []User) []AdminUserFormatter {
+	usersFormatter := []AdminUserFormatter{}
+
+	for _, user := range users {
+		usersFormatter = append(usersFormatter, FormatAdminUser(user))
+	}
+
+	return usersFormatter
+}
+
+type TwoFactorEnrollmentFormatter struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+func FormatTwoFactorEnrollment(secret string, uri string) TwoFactorEnrollmentFormatter {
+	formatter := TwoFactorEnrollmentFormatter{
+		Secret: secret,
+		URI:    uri,
+	}
+
+	return formatter
+}
+
+type RecoveryCodesFormatter struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func FormatRecoveryCodes(codes []string) RecoveryCodesFormatter {
+	formatter := RecoveryCodesFormatter{
+		RecoveryCodes: codes,
+	}
+
+	return formatter
+}
+
+// TwoFactorChallengeFormatter is returned by login instead of a session when
+// the account has two-factor login on.
+type TwoFactorChallengeFormatter struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+func FormatTwoFactorChallenge(token string, expiresAt time.Time) TwoFactorChallengeFormatter {
+	formatter := TwoFactorChallengeFormatter{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         expiresAt,
 	}
 
 	return formatter
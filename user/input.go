@@ -15,3 +15,58 @@ type LoginInput struct {
 type CheckEmailInput struct {
 	Email string `json:"email" binding:"required,email"`
 }
+
+type GetUserInput struct {
+	ID int `uri:"id" binding:"required"`
+}
+
+type GrantRoleInput struct {
+	Role   string `json:"role" binding:"required"`
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+type RevokeRoleInput struct {
+	ID   int    `uri:"id" binding:"required"`
+	Role string `uri:"role" binding:"required"`
+}
+
+type SearchUsersInput struct {
+	Query  string `form:"q"`
+	Status string `form:"status" binding:"omitempty,oneof=active suspended"`
+	Limit  int    `form:"limit" binding:"gte=0,lte=100"`
+	Cursor string `form:"cursor"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginInput completes a login started with a password. Code is
+// either a code from the authenticator app or an unused recovery code.
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
@@ -1,12 +1,27 @@
 package user
 
-import "gorm.io/gorm"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Repository interface {
 	Save(user User) (User, error)
 	FindByEmail(email string) (User, error)
 	FindById(id int) (User, error)
 	Update(user User) (User, error)
+	FindAll(query string, status string, offset int, limit int) ([]User, int64, error)
+	SavePasswordResetToken(token PasswordResetToken) (PasswordResetToken, error)
+	FindPasswordResetToken(tokenHash string) (PasswordResetToken, error)
+	ResetPassword(token PasswordResetToken, passwordHash string) (bool, error)
+	UpdatePassword(user User, passwordHash string) (User, error)
+	EnableTwoFactor(user User, counter int64, codeHashes []string) (User, error)
+	DisableTwoFactor(user User) (User, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	AdvanceTOTPCounter(userID int, counter int64) (bool, error)
 }
 
 type repository struct {
@@ -49,8 +64,10 @@ func (r *repository) FindById(id int) (User, error) {
 	return user, nil
 }
 
+// Update saves the user. The two-factor state it omits has dedicated
+// methods that guard against concurrent logins.
 func (r *repository) Update(user User) (User, error) {
-	err := r.db.Save(&user).Error
+	err := r.db.Omit("TOTPLastCounter", "TwoFactorEnabledAt").Save(&user).Error
 
 	if err != nil {
 		return user, err
@@ -58,3 +75,220 @@ func (r *repository) Update(user User) (User, error) {
 
 	return user, nil
 }
+
+// FindAll lists users whose name or email contains query, newest first.
+// status is "active", "suspended" or empty for both.
+func (r *repository) FindAll(query string, status string, offset int, limit int) ([]User, int64, error) {
+	var users []User
+	var total int64
+
+	db := r.db.Model(&User{})
+
+	if query != "" {
+		like := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(query) + "%"
+		db = db.Where("name LIKE ? OR email LIKE ?", like, like)
+	}
+
+	switch status {
+	case "active":
+		db = db.Where("suspended_at IS NULL")
+	case "suspended":
+		db = db.Where("suspended_at IS NOT NULL")
+	}
+
+	err := db.Count(&total).Error
+
+	if err != nil {
+		return users, total, err
+	}
+
+	err = db.Order("id desc").Offset(offset).Limit(limit).Find(&users).Error
+
+	if err != nil {
+		return users, total, err
+	}
+
+	return users, total, nil
+}
+
+func (r *repository) SavePasswordResetToken(token PasswordResetToken) (PasswordResetToken, error) {
+	err := r.db.Create(&token).Error
+
+	if err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+func (r *repository) FindPasswordResetToken(tokenHash string) (PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := r.db.Where("token_hash = ?", tokenHash).Find(&token).Error
+
+	if err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+// ResetPassword uses token and sets the new password in one DB transaction.
+// It reports false when the token was already used, and burns every other
+// outstanding token of the user.
+func (r *repository) ResetPassword(token PasswordResetToken, passwordHash string) (bool, error) {
+	used := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		err := tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now).Error
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&User{}).Where("id = ?", token.UserID).
+			Updates(map[string]interface{}{"password_hash": passwordHash, "password_changed_at": now}).Error
+
+		if err != nil {
+			return err
+		}
+
+		used = true
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return used, nil
+}
+
+func (r *repository) UpdatePassword(user User, passwordHash string) (User, error) {
+	now := time.Now()
+	err := r.db.Model(&user).Updates(map[string]interface{}{"password_hash": passwordHash, "password_changed_at": now}).Error
+
+	if err != nil {
+		return user, err
+	}
+
+	user.PasswordHash = passwordHash
+	user.PasswordChangedAt = &now
+
+	return user, nil
+}
+
+// EnableTwoFactor turns two-factor login on and stores the first set of
+// recovery codes in one DB transaction.
+func (r *repository) EnableTwoFactor(user User, counter int64, codeHashes []string) (User, error) {
+	now := time.Now()
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{"two_factor_enabled_at": now, "totp_last_counter": counter}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, user.ID, codeHashes)
+	})
+
+	if err != nil {
+		return user, err
+	}
+
+	user.TwoFactorEnabledAt = &now
+	user.TOTPLastCounter = counter
+
+	return user, nil
+}
+
+func (r *repository) DisableTwoFactor(user User) (User, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": "", "totp_last_counter": 0, "two_factor_enabled_at": nil}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	})
+
+	if err != nil {
+		return user, err
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.TwoFactorEnabledAt = nil
+
+	return user, nil
+}
+
+func (r *repository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseRecoveryCode marks the user's matching code as used. It reports false
+// when there is no such unused code, including when a concurrent request
+// used it first.
+func (r *repository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result := r.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Limit(1).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// AdvanceTOTPCounter records the time step of an accepted code. It reports
+// false when that step, or a later one, was already used, so each code
+// works only once.
+func (r *repository) AdvanceTOTPCounter(userID int, counter int64) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		Update("totp_last_counter", counter)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int, codeHashes []string) error {
+	err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+
+	if err != nil {
+		return err
+	}
+
+	codes := make([]RecoveryCode, 0, len(codeHashes))
+
+	for _, hash := range codeHashes {
+		codes = append(codes, RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+
+	return tx.Create(&codes).Error
+}
@@ -2,6 +2,14 @@ package user
 
 import (
 	"errors"
+	"fmt"
+	"go_crowdfund/helper"
+	"go_crowdfund/mailer"
+	encryption "go_crowdfund/secret"
+	"go_crowdfund/totp"
+	"net/url"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -10,16 +18,69 @@ type Service interface {
 	RegisterUser(input RegisterUserInput) (User, error)
 	Login(input LoginInput) (User, error)
 	IsEmailAvailable(input CheckEmailInput) (bool, error)
-	SaveAvatar(ID int, fileLocation string) (User, error)
+	SaveAvatar(ID int, fileLocation string, variants []string) (User, error)
 	GetUserByID(ID int) (User, error)
+	GrantRole(ID int, role string) (User, error)
+	RevokeRole(input RevokeRoleInput, currentUser User) (User, error)
+	SearchUsers(input SearchUsersInput) ([]User, helper.Pagination, error)
+	SuspendUser(ID int, reason string, currentUser User) (User, error)
+	ReinstateUser(ID int) (User, error)
+	SendVerificationEmail(user User) error
+	VerifyEmail(input VerifyEmailInput) (User, error)
+	RequestPasswordReset(input ForgotPasswordInput) error
+	ResetPassword(input ResetPasswordInput) (User, error)
+	ChangePassword(ID int, input ChangePasswordInput) (User, error)
+	EnrollTwoFactor(ID int) (string, string, error)
+	ConfirmTwoFactor(ID int, input TwoFactorCodeInput) ([]string, error)
+	DisableTwoFactor(ID int, input DisableTwoFactorInput) (User, error)
+	RegenerateRecoveryCodes(ID int, input TwoFactorCodeInput) ([]string, error)
+	CreateTwoFactorChallenge(user User) (string, time.Time)
+	ParseTwoFactorChallenge(token string) (User, error)
+	VerifySecondFactor(user User, code string) error
+}
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid email or password")
+	ErrInvalidResetToken  = errors.New("Invalid or expired password reset token")
+	ErrInvalidTwoFactor   = errors.New("Invalid two-factor code")
+)
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.MinCost)
+
+const (
+	DefaultPageSize = 20
+
+	recoveryCodeCount = 10
+)
+
+// EmailLinks configures the links emailed to users. Each URL is a page that
+// posts the token from its query string back to the API. TokenSecret signs
+// verification tokens.
+type EmailLinks struct {
+	TokenSecret      string
+	VerificationURL  string
+	VerificationTTL  time.Duration
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+}
+
+// TwoFactor configures TOTP two-factor login. EncryptionKey seals the TOTP
+// secrets at rest; Issuer is the name shown in authenticator apps.
+type TwoFactor struct {
+	Issuer        string
+	EncryptionKey string
+	ChallengeTTL  time.Duration
 }
 
 type service struct {
 	repository Repository
+	mailer     mailer.Mailer
+	links      EmailLinks
+	twoFactor  TwoFactor
 }
 
-func NewService(repository Repository) *service {
-	return &service{repository}
+func NewService(repository Repository, mailer mailer.Mailer, links EmailLinks, twoFactor TwoFactor) *service {
+	return &service{repository, mailer, links, twoFactor}
 }
 
 func (s *service) RegisterUser(input RegisterUserInput) (User, error) {
@@ -28,14 +89,14 @@ func (s *service) RegisterUser(input RegisterUserInput) (User, error) {
 	user.Email = input.Email
 	user.Occupation = input.Occupation
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.MinCost)
+	passwordHash, err := hashPassword(input.Password)
 
 	if err != nil {
 		return user, err
 	}
 
-	user.PasswordHash = string(passwordHash)
-	user.Role = "user"
+	user.PasswordHash = passwordHash
+	user.Role = RoleUser
 
 	createUser, err := s.repository.Save(user)
 	if err != nil {
@@ -56,13 +117,19 @@ func (s *service) Login(input LoginInput) (User, error) {
 	}
 
 	if user.ID == 0 {
-		return user, errors.New("No user found on that email")
+		// Compare anyway so unknown emails take as long as wrong passwords.
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return User{}, ErrInvalidCredentials
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 
 	if err != nil {
-		return user, err
+		return User{}, ErrInvalidCredentials
+	}
+
+	if user.IsSuspended() {
+		return user, errors.New("This account has been suspended")
 	}
 
 	return user, nil
@@ -84,7 +151,7 @@ func (s *service) IsEmailAvailable(input CheckEmailInput) (bool, error) {
 	return false, nil
 }
 
-func (s *service) SaveAvatar(ID int, fileLocation string) (User, error) {
+func (s *service) SaveAvatar(ID int, fileLocation string, variants []string) (User, error) {
 	user, err := s.repository.FindById(ID)
 
 	if err != nil {
@@ -92,6 +159,7 @@ func (s *service) SaveAvatar(ID int, fileLocation string) (User, error) {
 	}
 
 	user.AvatarFileName = fileLocation
+	user.AvatarVariants = strings.Join(variants, ",")
 
 	updatedUser, err := s.repository.Update(user)
 
@@ -115,3 +183,540 @@ func (s *service) GetUserByID(ID int) (User, error) {
 
 	return user, nil
 }
+
+func (s *service) GrantRole(ID int, role string) (User, error) {
+	if !isKnownRole(role) {
+		return User{}, errors.New("unknown role " + role)
+	}
+
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.HasRole(role) {
+		return user, nil
+	}
+
+	user.Role = strings.Join(append(user.Roles(), role), ",")
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+func (s *service) RevokeRole(input RevokeRoleInput, currentUser User) (User, error) {
+	if !isKnownRole(input.Role) {
+		return User{}, errors.New("unknown role " + input.Role)
+	}
+
+	if input.ID == currentUser.ID && input.Role == RoleAdmin {
+		return User{}, errors.New("admins cannot revoke their own admin role")
+	}
+
+	user, err := s.GetUserByID(input.ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	var roles []string
+	for _, role := range user.Roles() {
+		if role != input.Role {
+			roles = append(roles, role)
+		}
+	}
+
+	user.Role = strings.Join(roles, ",")
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+func (s *service) SearchUsers(input SearchUsersInput) ([]User, helper.Pagination, error) {
+	offset, err := helper.DecodeCursor(input.Cursor)
+
+	if err != nil {
+		return []User{}, helper.Pagination{}, err
+	}
+
+	limit := input.Limit
+
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+
+	users, total, err := s.repository.FindAll(input.Query, input.Status, offset, limit)
+
+	if err != nil {
+		return users, helper.Pagination{}, err
+	}
+
+	return users, helper.NewPagination(total, offset, limit), nil
+}
+
+func (s *service) SuspendUser(ID int, reason string, currentUser User) (User, error) {
+	if ID == currentUser.ID {
+		return User{}, errors.New("you cannot suspend yourself")
+	}
+
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.IsSuspended() {
+		return user, errors.New("user is already suspended")
+	}
+
+	now := time.Now()
+	user.SuspendedAt = &now
+	user.SuspensionReason = reason
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+func (s *service) ReinstateUser(ID int) (User, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if !user.IsSuspended() {
+		return user, errors.New("user is not suspended")
+	}
+
+	user.SuspendedAt = nil
+	user.SuspensionReason = ""
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+func (s *service) SendVerificationEmail(user User) error {
+	if user.IsVerified() {
+		return errors.New("email is already verified")
+	}
+
+	token := newSignedToken([]byte(s.links.TokenSecret), purposeEmailVerification, user, time.Now().Add(s.links.VerificationTTL))
+	link := s.links.VerificationURL + "?token=" + url.QueryEscape(token)
+
+	message := mailer.Message{}
+	message.To = user.Email
+	message.Subject = "Verify your email address"
+	message.Body = fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n", user.Name, int(s.links.VerificationTTL.Hours()), link)
+
+	return s.mailer.Send(message)
+}
+
+func (s *service) VerifyEmail(input VerifyEmailInput) (User, error) {
+	userID, email, ok := parseSignedToken([]byte(s.links.TokenSecret), purposeEmailVerification, input.Token, time.Now())
+
+	if !ok {
+		return User{}, ErrInvalidVerificationToken
+	}
+
+	user, err := s.repository.FindById(userID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.ID == 0 || user.Email != email {
+		return User{}, ErrInvalidVerificationToken
+	}
+
+	if user.IsVerified() {
+		return user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+// RequestPasswordReset emails a reset link when the address belongs to a user.
+// It reports success either way, so it cannot be used to probe for accounts.
+func (s *service) RequestPasswordReset(input ForgotPasswordInput) error {
+	user, err := s.repository.FindByEmail(input.Email)
+
+	if err != nil {
+		return err
+	}
+
+	if user.ID == 0 || user.IsSuspended() {
+		return nil
+	}
+
+	plain, err := randomToken()
+
+	if err != nil {
+		return err
+	}
+
+	token := PasswordResetToken{}
+	token.UserID = user.ID
+	token.TokenHash = hashToken(plain)
+	token.ExpiresAt = time.Now().Add(s.links.PasswordResetTTL)
+
+	_, err = s.repository.SavePasswordResetToken(token)
+
+	if err != nil {
+		return err
+	}
+
+	link := s.links.PasswordResetURL + "?token=" + url.QueryEscape(plain)
+
+	message := mailer.Message{}
+	message.To = user.Email
+	message.Subject = "Reset your password"
+	message.Body = fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. Open the link below to choose a new one. It can be used once and expires in %d minutes.\n\n%s\n\nIf it was not you, you can ignore this email; your password has not been changed.\n", user.Name, int(s.links.PasswordResetTTL.Minutes()), link)
+
+	return s.mailer.Send(message)
+}
+
+func (s *service) ResetPassword(input ResetPasswordInput) (User, error) {
+	token, err := s.repository.FindPasswordResetToken(hashToken(input.Token))
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if token.ID == 0 || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return User{}, ErrInvalidResetToken
+	}
+
+	passwordHash, err := hashPassword(input.Password)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	used, err := s.repository.ResetPassword(token, passwordHash)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if !used {
+		return User{}, ErrInvalidResetToken
+	}
+
+	return s.GetUserByID(token.UserID)
+}
+
+func (s *service) ChangePassword(ID int, input ChangePasswordInput) (User, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	// Users who signed up through a sign-in provider have no password yet
+	// and set their first one without a current password.
+	if user.PasswordHash != "" {
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.CurrentPassword))
+
+		if err != nil {
+			return user, errors.New("current password is incorrect")
+		}
+	}
+
+	passwordHash, err := hashPassword(input.NewPassword)
+
+	if err != nil {
+		return user, err
+	}
+
+	updatedUser, err := s.repository.UpdatePassword(user, passwordHash)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+// EnrollTwoFactor stores a new TOTP secret and returns it with its otpauth
+// URI. Two-factor login stays off until a code is confirmed, so an abandoned
+// enrollment never locks the user out.
+func (s *service) EnrollTwoFactor(ID int) (string, string, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if user.HasTwoFactor() {
+		return "", "", errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := encryption.Seal([]byte(s.twoFactor.EncryptionKey), []byte(secret))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	user.TOTPSecret = sealed
+
+	_, err = s.repository.Update(user)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(s.twoFactor.Issuer, user.Email, secret), nil
+}
+
+// ConfirmTwoFactor turns two-factor login on once the user proves their app
+// produces valid codes, and returns the recovery codes. They are only ever
+// shown here.
+func (s *service) ConfirmTwoFactor(ID int, input TwoFactorCodeInput) ([]string, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user.HasTwoFactor() {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	if user.TOTPSecret == "" {
+		return nil, errors.New("start two-factor enrollment first")
+	}
+
+	secret, err := s.totpSecret(user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counter, ok := totp.Validate(secret, input.Code, time.Now(), user.TOTPLastCounter)
+
+	if !ok {
+		return nil, ErrInvalidTwoFactor
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.repository.EnableTwoFactor(user, counter, hashes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *service) DisableTwoFactor(ID int, input DisableTwoFactorInput) (User, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if !user.HasTwoFactor() {
+		return user, errors.New("two-factor authentication is not enabled")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
+
+	if err != nil {
+		return user, errors.New("password is incorrect")
+	}
+
+	err = s.VerifySecondFactor(user, input.Code)
+
+	if err != nil {
+		return user, err
+	}
+
+	updatedUser, err := s.repository.DisableTwoFactor(user)
+
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user, used or
+// not, with a fresh set.
+func (s *service) RegenerateRecoveryCodes(ID int, input TwoFactorCodeInput) ([]string, error) {
+	user, err := s.GetUserByID(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.HasTwoFactor() {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+
+	err = s.VerifySecondFactor(user, input.Code)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repository.ReplaceRecoveryCodes(user.ID, hashes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CreateTwoFactorChallenge returns the short-lived token login hands out
+// instead of a session. It proves the password was right and nothing more.
+func (s *service) CreateTwoFactorChallenge(user User) (string, time.Time) {
+	expiresAt := time.Now().Add(s.twoFactor.ChallengeTTL)
+
+	return newSignedToken([]byte(s.links.TokenSecret), purposeTwoFactor, user, expiresAt), expiresAt
+}
+
+func (s *service) ParseTwoFactorChallenge(token string) (User, error) {
+	userID, email, ok := parseSignedToken([]byte(s.links.TokenSecret), purposeTwoFactor, token, time.Now())
+
+	if !ok {
+		return User{}, ErrInvalidChallengeToken
+	}
+
+	user, err := s.repository.FindById(userID)
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.ID == 0 || user.Email != email || !user.HasTwoFactor() {
+		return User{}, ErrInvalidChallengeToken
+	}
+
+	if user.IsSuspended() {
+		return user, errors.New("This account has been suspended")
+	}
+
+	return user, nil
+}
+
+// VerifySecondFactor accepts a current code from the authenticator app or an
+// unused recovery code. Either works only once.
+func (s *service) VerifySecondFactor(user User, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if len(code) == totp.Digits {
+		secret, err := s.totpSecret(user)
+
+		if err != nil {
+			return err
+		}
+
+		counter, ok := totp.Validate(secret, code, time.Now(), user.TOTPLastCounter)
+
+		if !ok {
+			return ErrInvalidTwoFactor
+		}
+
+		advanced, err := s.repository.AdvanceTOTPCounter(user.ID, counter)
+
+		if err != nil {
+			return err
+		}
+
+		if !advanced {
+			return ErrInvalidTwoFactor
+		}
+
+		return nil
+	}
+
+	used, err := s.repository.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)))
+
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactor
+	}
+
+	return nil
+}
+
+func (s *service) totpSecret(user User) (string, error) {
+	secret, err := encryption.Open([]byte(s.twoFactor.EncryptionKey), user.TOTPSecret)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func hashPassword(password string) (string, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(passwordHash), nil
+}
+
+func isKnownRole(role string) bool {
+	for _, known := range Roles {
+		if known == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,340 @@
+package user
+
+import (
+	"go_crowdfund/mailer"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryRepository implements the part of Repository registration,
+// verification and password resets use; anything else panics.
+type memoryRepository struct {
+	Repository
+	users  map[int]User
+	tokens map[int]PasswordResetToken
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{users: map[int]User{}, tokens: map[int]PasswordResetToken{}}
+}
+
+func (r *memoryRepository) Save(user User) (User, error) {
+	user.ID = len(r.users) + 1
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryRepository) Update(user User) (User, error) {
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryRepository) FindById(ID int) (User, error) {
+	return r.users[ID], nil
+}
+
+func (r *memoryRepository) FindByEmail(email string) (User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return User{}, nil
+}
+
+func (r *memoryRepository) UpdatePassword(user User, passwordHash string) (User, error) {
+	now := time.Now()
+	user.PasswordHash = passwordHash
+	user.PasswordChangedAt = &now
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryRepository) SavePasswordResetToken(token PasswordResetToken) (PasswordResetToken, error) {
+	token.ID = len(r.tokens) + 1
+	r.tokens[token.ID] = token
+	return token, nil
+}
+
+func (r *memoryRepository) FindPasswordResetToken(tokenHash string) (PasswordResetToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+
+	return PasswordResetToken{}, nil
+}
+
+func (r *memoryRepository) ResetPassword(token PasswordResetToken, passwordHash string) (bool, error) {
+	if r.tokens[token.ID].UsedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+
+	for ID, other := range r.tokens {
+		if other.UserID == token.UserID && other.UsedAt == nil {
+			other.UsedAt = &now
+			r.tokens[ID] = other
+		}
+	}
+
+	user := r.users[token.UserID]
+	user.PasswordHash = passwordHash
+	r.users[user.ID] = user
+
+	return true, nil
+}
+
+var testLinks = EmailLinks{
+	TokenSecret:      "email-token-secret-for-tests-only",
+	VerificationURL:  "https://app.example.com/verify",
+	VerificationTTL:  24 * time.Hour,
+	PasswordResetURL: "https://app.example.com/reset-password",
+	PasswordResetTTL: time.Hour,
+}
+
+func newTestService() (*service, *memoryRepository, *mailer.MemoryMailer) {
+	repository := newMemoryRepository()
+	mail := mailer.NewMemoryMailer()
+
+	return NewService(repository, mail, testLinks, TwoFactor{}), repository, mail
+}
+
+// linkToken returns the token of the link to page in the last message sent
+// to email.
+func linkToken(t *testing.T, mail *mailer.MemoryMailer, email string, page string) string {
+	message, ok := mail.Last(email)
+
+	if !ok {
+		t.Fatalf("no email was sent to %s", email)
+	}
+
+	for _, field := range strings.Fields(message.Body) {
+		if !strings.HasPrefix(field, page+"?") {
+			continue
+		}
+
+		link, err := url.Parse(field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return link.Query().Get("token")
+	}
+
+	t.Fatalf("no link to %s in %q", page, message.Body)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	service, _, mail := newTestService()
+
+	user, err := service.RegisterUser(RegisterUserInput{Name: "Ana", Occupation: "Baker", Email: "ana@example.com", Password: "correct horse"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.IsVerified() {
+		t.Fatal("a new user starts out verified")
+	}
+
+	err = service.SendVerificationEmail(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, _ := mail.Last("ana@example.com")
+
+	if message.Subject != "Verify your email address" {
+		t.Fatalf("unexpected subject %q", message.Subject)
+	}
+
+	token := linkToken(t, mail, "ana@example.com", testLinks.VerificationURL)
+
+	_, err = service.VerifyEmail(VerifyEmailInput{Token: token[:len(token)-1] + "x"})
+
+	if err != ErrInvalidVerificationToken {
+		t.Fatalf("accepted a tampered token, err %v", err)
+	}
+
+	verified, err := service.VerifyEmail(VerifyEmailInput{Token: token})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verified.IsVerified() {
+		t.Fatal("user is not verified")
+	}
+
+	again, err := service.VerifyEmail(VerifyEmailInput{Token: token})
+
+	if err != nil || !again.EmailVerifiedAt.Equal(*verified.EmailVerifiedAt) {
+		t.Fatalf("verifying twice changed the user: %+v, err %v", again, err)
+	}
+
+	mail.Reset()
+
+	err = service.SendVerificationEmail(verified)
+
+	if err == nil || len(mail.Messages()) != 0 {
+		t.Fatalf("sent a verification email to a verified user, err %v", err)
+	}
+}
+
+func TestVerifyEmailRejectsStaleTokens(t *testing.T) {
+	service, repository, mail := newTestService()
+
+	user, err := service.RegisterUser(RegisterUserInput{Name: "Ana", Occupation: "Baker", Email: "ana@example.com", Password: "correct horse"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.SendVerificationEmail(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := linkToken(t, mail, "ana@example.com", testLinks.VerificationURL)
+
+	// A link sent to the old address must not verify the new one.
+	user.Email = "ana@example.org"
+	repository.Update(user)
+
+	_, err = service.VerifyEmail(VerifyEmailInput{Token: token})
+
+	if err != ErrInvalidVerificationToken {
+		t.Fatalf("verified a changed email with the old link, err %v", err)
+	}
+
+	expired := newSignedToken([]byte(testLinks.TokenSecret), purposeEmailVerification, user, time.Now().Add(-time.Minute))
+
+	_, err = service.VerifyEmail(VerifyEmailInput{Token: expired})
+
+	if err != ErrInvalidVerificationToken {
+		t.Fatalf("accepted an expired token, err %v", err)
+	}
+
+	forged := newSignedToken([]byte("another-secret"), purposeEmailVerification, user, time.Now().Add(time.Hour))
+
+	_, err = service.VerifyEmail(VerifyEmailInput{Token: forged})
+
+	if err != ErrInvalidVerificationToken {
+		t.Fatalf("accepted a token signed with another secret, err %v", err)
+	}
+
+	if repository.users[user.ID].IsVerified() {
+		t.Fatal("user was verified")
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	service, _, mail := newTestService()
+
+	user, err := service.RegisterUser(RegisterUserInput{Name: "Ana", Occupation: "Baker", Email: "ana@example.com", Password: "correct horse"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.RequestPasswordReset(ForgotPasswordInput{Email: "nobody@example.com"})
+
+	if err != nil || len(mail.Messages()) != 0 {
+		t.Fatalf("unknown email: %d messages sent, err %v", len(mail.Messages()), err)
+	}
+
+	err = service.RequestPasswordReset(ForgotPasswordInput{Email: user.Email})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := linkToken(t, mail, user.Email, testLinks.PasswordResetURL)
+
+	_, err = service.ResetPassword(ResetPasswordInput{Token: token, Password: "battery staple"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Login(LoginInput{Email: user.Email, Password: "correct horse"})
+
+	if err != ErrInvalidCredentials {
+		t.Fatalf("the old password still works, err %v", err)
+	}
+
+	_, err = service.Login(LoginInput{Email: user.Email, Password: "battery staple"})
+
+	if err != nil {
+		t.Fatalf("the new password does not work: %v", err)
+	}
+
+	_, err = service.ResetPassword(ResetPasswordInput{Token: token, Password: "another one"})
+
+	if err != ErrInvalidResetToken {
+		t.Fatalf("a reset link worked twice, err %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	service, repository, _ := newTestService()
+
+	user, err := service.RegisterUser(RegisterUserInput{Name: "Ana", Occupation: "Baker", Email: "ana@example.com", Password: "correct horse"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.ChangePassword(user.ID, ChangePasswordInput{CurrentPassword: "wrong horse", NewPassword: "battery staple"})
+
+	if err == nil {
+		t.Fatal("changed the password without the current one")
+	}
+
+	_, err = service.ChangePassword(user.ID, ChangePasswordInput{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Login(LoginInput{Email: user.Email, Password: "battery staple"})
+
+	if err != nil {
+		t.Fatalf("the new password does not work: %v", err)
+	}
+
+	// Users created through a sign-in provider have no password to confirm.
+	provider, err := repository.Save(User{Name: "Bo", Email: "bo@example.com", Role: RoleUser})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.ChangePassword(provider.ID, ChangePasswordInput{NewPassword: "first password"})
+
+	if err != nil {
+		t.Fatalf("a user without a password cannot set one: %v", err)
+	}
+
+	_, err = service.Login(LoginInput{Email: provider.Email, Password: "first password"})
+
+	if err != nil {
+		t.Fatalf("the first password does not work: %v", err)
+	}
+
+	_, err = service.ChangePassword(provider.ID, ChangePasswordInput{NewPassword: "another password"})
+
+	if err == nil {
+		t.Fatal("changed a password that is now set without confirming it")
+	}
+}
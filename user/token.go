@@ -0,0 +1,130 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("Invalid or expired verification token")
+	ErrInvalidChallengeToken    = errors.New("Invalid or expired two-factor challenge")
+)
+
+// Purposes of signed tokens. The purpose is mixed into the signature so a
+// token issued for one flow cannot be replayed against another.
+const (
+	purposeEmailVerification = "email-verification"
+	purposeTwoFactor         = "two-factor-challenge"
+)
+
+// newSignedToken signs the user's ID, email and an expiry. Binding the email
+// means the token stops working if the address changes.
+func newSignedToken(secret []byte, purpose string, user User, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d:%d:%s", user.ID, expiresAt.Unix(), user.Email)
+	encodedPayload := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return encodedPayload + "." + signPayload(secret, purpose, encodedPayload)
+}
+
+// parseSignedToken returns the user ID and email a valid token was issued
+// for. ok is false for any malformed, forged or expired token.
+func parseSignedToken(secret []byte, purpose string, token string, now time.Time) (int, string, bool) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+
+	expected := signPayload(secret, purpose, parts[0])
+
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return 0, "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return 0, "", false
+	}
+
+	fields := strings.SplitN(string(payload), ":", 3)
+
+	if len(fields) != 3 {
+		return 0, "", false
+	}
+
+	userID, err := strconv.Atoi(fields[0])
+
+	if err != nil {
+		return 0, "", false
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+
+	if err != nil || now.Unix() > expiresAt {
+		return 0, "", false
+	}
+
+	return userID, fields[2], true
+}
+
+func signPayload(secret []byte, purpose string, encodedPayload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose + ":" + encodedPayload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+
+	_, err := rand.Read(buf)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// newRecoveryCodes returns recovery codes formatted for display, like
+// "k3v9q-xm2pd", and their hashes for storage.
+func newRecoveryCodes() ([]string, []string, error) {
+	var codes []string
+	var hashes []string
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+
+		_, err := rand.Read(buf)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))[:10]
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}